@@ -1,91 +1,167 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/azbashar/teka/internal/addtx"
 	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/entry"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/prompt"
 	"github.com/spf13/cobra"
 )
 
-type LineType int
+var currentFile string
 
+// Exit codes of teka add, so scripts can tell what happened.
 const (
-	LineTransaction LineType = iota
-	LinePosting
-	LineComment
+	exitAdded    = 0 // written and hledger check passed
+	exitFailed   = 1 // the journal could not be written or reverted
+	exitRejected = 2 // invalid input or discarded, nothing was written
+	exitReverted = 3 // hledger check failed and the entry was removed again
+	exitKept     = 4 // hledger check failed and the entry was kept anyway
 )
 
-type Line struct {
-	Type    LineType
-	Date    string // for LineTransaction
-	Note    string // for LineTransaction
-	Account string // for LinePosting
-	Amount  string // for LinePosting
-	Text    string // for LineComment
-	Indent  bool   // true for ';', false for '#'
-}
-
-type Transaction struct {
-	Lines []Line
-}
-
-var currentFile string
-
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Add a new transaction to your ledger",
+	Long: `Add a new transaction to your ledger.
+
+Without flags, teka add asks for the transaction step by step. It can also
+take a whole transaction from --date, --desc and --posting flags, or from
+stdin with --stdin as JSON or journal text, for use in scripts.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fileArg = rootCmd.Flag("file").Value.String()
 		mainFileArg = rootCmd.Flag("mainfile").Value.String()
-		// Collect transaction data
-		tx := Transaction{}
-
-		// Date
-	AskDate:
-		date := Ask("Date?")
-		if date == "" {
-			fmt.Println("Abort.")
-			return
-		}
 
-		// Comment
-		if date == ";" || date == "#" {
-			comment := Ask("Comment?")
-			tx.Lines = append(tx.Lines, Line{
-				Type:   LineComment,
-				Text:   comment,
-				Indent: false,
-			})
-			goto AskDate
+		// a template fills in everything but the date, so the other
+		// flags for scripts would be ignored
+		if addTemplate != "" {
+			for _, name := range []string{"desc", "status", "code", "payee", "tag", "posting", "stdin"} {
+				if cmd.Flags().Changed(name) {
+					fmt.Println("--" + name + " can't be used with --template, only --date can.")
+					os.Exit(exitRejected)
+				}
+			}
 		}
 
-		// Parse date shortcuts
-		date, err := ParseDate(date)
-		if err != nil {
-			fmt.Println(err)
-			return
+		scripted := addTemplate == "" && (addStdin || addDate != "" || addDesc != "" || addStatus != "" ||
+			addCode != "" || addPayee != "" || len(addTags) > 0 || len(addPostings) > 0)
+		var tx entry.Transaction
+		if scripted {
+			var err error
+			tx, err = scriptedTransaction()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(exitRejected)
+			}
+		} else {
+			var t *config.Template
+			if addTemplate != "" {
+				t = findTemplate(addTemplate)
+				if t == nil {
+					fmt.Println("No template named " + addTemplate + ".")
+					os.Exit(exitRejected)
+				}
+				if addDate != "" {
+					dated := *t
+					dated.Date = addDate
+					t = &dated
+				}
+			}
+			var ok bool
+			tx, ok = askTransaction(t)
+			if !ok {
+				os.Exit(exitRejected)
+			}
 		}
 
-		currentFile, err = fileselector.GetCurrentFile(date, fileArg)
-		if err != nil {
-			fmt.Println(err)
-			return
+		code := commitTransaction(tx, !scripted)
+		if code == exitAdded && addSaveTemplate != "" {
+			if err := saveTemplate(addSaveTemplate, tx); err != nil {
+				fmt.Println("Error saving template:", err)
+			} else {
+				fmt.Println("Saved as template " + addSaveTemplate + ".")
+			}
+		}
+		if code != exitAdded {
+			os.Exit(code)
 		}
+	},
+}
+
+// askTransaction collects a transaction at the prompts. With a template
+// only its date (unless it has one) and placeholders are asked. It returns
+// false when the user aborted or an answer could not be used.
+func askTransaction(t *config.Template) (entry.Transaction, bool) {
+	tx := entry.Transaction{}
+
+	// Date
+	date := ""
+	if t != nil {
+		date = t.Date
+	}
+AskDate:
+	if date == "" {
+		date = Ask("Date?")
+	}
+	if date == "" {
+		fmt.Println("Abort.")
+		return tx, false
+	}
+
+	// Comment
+	if date == ";" || date == "#" {
+		comment := Ask("Comment?")
+		tx.Lines = append(tx.Lines, entry.Line{
+			Type:   entry.LineComment,
+			Text:   comment,
+			Indent: false,
+		})
+		date = ""
+		goto AskDate
+	}
 
-		// Note
+	// Parse date shortcuts
+	date, err := ParseDate(date)
+	if err != nil {
+		fmt.Println(err)
+		return tx, false
+	}
+	fmt.Println("Date:", describeDate(date))
+
+	currentFile, err = fileselector.GetCurrentFile(primaryDate(date), fileArg)
+	if err != nil {
+		fmt.Println(err)
+		return tx, false
+	}
+
+	// Note
+	note := ""
+	if t == nil {
 	AskNote:
-		note := Ask("Note?")
+		note = AskCompleting("Note?", completeNote)
 
-		// Note search
-		if strings.HasPrefix(note, ".") {
+		if name, ok := strings.CutPrefix(note, ".t:"); ok {
+			// Template shortcut
+			t = findTemplate(name)
+			if t == nil {
+				fmt.Println("No template named " + name + ".")
+				goto AskNote
+			}
+		} else if strings.HasPrefix(note, ".") {
+			// Note search
 			var searchTerm string
 			if note == "." {
 				searchTerm = ""
@@ -102,170 +178,315 @@ var addCmd = &cobra.Command{
 			}
 			note = selected
 		}
+	}
 
-		tx.Lines = append(tx.Lines, Line{
-			Type: LineTransaction,
-			Date: date,
-			Note: note,
-		})
+	// A template fills in the rest
+	if t != nil {
+		tx.Lines = append(tx.Lines, templateLines(*t, date)...)
+		askDocument()
+		return tx, true
+	}
 
-		// Postings
-		for {
-			// Account
-			account := Ask("Account?")
-			if account == "" {
-				break
-			}
+	// Status, code, payee and tags are typed with the note
+	header := entry.ParseHeader(date, note)
+	tx.Lines = append(tx.Lines, header)
 
-			// Account search
-			if strings.HasPrefix(account, ".") {
-				var searchTerm string
-				if account == "." {
-					searchTerm = ""
-				} else {
-					searchTerm = account[1:]
-				}
-				selected, err := SearchRecords("accounts", searchTerm)
-				if err != nil {
-					fmt.Println("Error searching accounts:", err)
-					continue
-				}
-				if selected == "" {
-					continue
-				}
-				account = selected
-			}
+	// The postings of the latest transaction with this note are offered as
+	// defaults, one after another
+	defaults := previousPostings(header.Description())
+	var suggested entry.Line
 
-			// Check if converting currencies
-			if strings.HasPrefix(account, "$") {
-				err := convertCurrencies(&tx, account)
-				if err != nil {
-					fmt.Println("Can not calculate gain:", err, "\nTry adding the transacion manually.")
-					return
-				}
-				break
-			}
+	// Postings
+	for {
+		suggested = entry.Line{}
+		if len(defaults) > 0 {
+			suggested = defaults[0]
+		}
 
-			// Comment
-			if account == ";" || account == "#" {
-				comment := Ask("Comment?")
-				tx.Lines = append(tx.Lines, Line{
-					Type:   LineComment,
-					Text:   comment,
-					Indent: account == ";",
-				})
+		// Account
+		account := askDefault("Account?", suggested.Account, completeAccount)
+		if account == "" {
+			break
+		}
+
+		// Account search
+		if strings.HasPrefix(account, ".") {
+			var searchTerm string
+			if account == "." {
+				searchTerm = ""
+			} else {
+				searchTerm = account[1:]
+			}
+			selected, err := SearchRecords("accounts", searchTerm)
+			if err != nil {
+				fmt.Println("Error searching accounts:", err)
 				continue
 			}
+			if selected == "" {
+				continue
+			}
+			account = selected
+		}
 
-			// Amount
-		AskAmount:
-			amount := Ask("Amount?")
-			// Auto balance
-			if amount == "." {
-				bal, err := calculateBalanceAmount(&tx)
-				if err != nil {
-					fmt.Println("Error balancing transaction:", err)
-					goto AskAmount
-				}
-				amount = bal
+		// Check if converting currencies
+		if strings.HasPrefix(account, "$") {
+			err := convertCurrencies(&tx, account)
+			if err != nil {
+				fmt.Println("Can not calculate gain:", err, "\nTry adding the transacion manually.")
+				return tx, false
 			}
+			break
+		}
 
-			tx.Lines = append(tx.Lines, Line{
-				Type:    LinePosting,
-				Account: account,
-				Amount:  amount,
+		// Comment
+		if account == ";" || account == "#" {
+			comment := Ask("Comment?")
+			tx.Lines = append(tx.Lines, entry.Line{
+				Type:   entry.LineComment,
+				Text:   comment,
+				Indent: account == ";",
 			})
+			continue
 		}
 
-		// Format the transaction as text
-		content := "\n"
-		for _, line := range tx.Lines {
-			switch line.Type {
-			case LineComment:
-				if line.Indent {
-					content += "    " + line.Text + "\n"
-				} else {
-					content += line.Text + "\n"
-				}
-			case LineTransaction:
-				content += fmt.Sprintf("%s %s\n", line.Date, line.Note)
-			case LinePosting:
-				// negative amounts will align with the posetive amounts
-				column := config.Cfg.AmountColumn
-				if strings.HasPrefix(line.Amount, "-") {
-					column = config.Cfg.AmountColumn - 1
-				}
-				content += fmt.Sprintf(
-					"    %-*s %s\n",
-					column,
-					line.Account,
-					line.Amount,
-				)
-			}
+		// Amount
+		// Suggestions follow the postings, not comments
+		if len(defaults) > 0 {
+			defaults = defaults[1:]
 		}
 
-		// Display the collected transaction
-		fmt.Printf("\nAdding this following transaction to %s:\n", currentFile)
-		fmt.Printf("%s\n", content)
-
-		// Confirm before writing
-		if !Confirm("Is this correct") {
-			fmt.Println("Transaction discarded.")
-			return
+	AskAmount:
+		amount := askDefault("Amount?", suggested.Amount, nil)
+		posting := entry.ParsePosting(account, amount)
+		var others []string
+		// Auto balance, keeping the tags and comment typed after the dot
+		if value, comment, _ := strings.Cut(posting.Amount, ";"); strings.TrimSpace(value) == "." {
+			amounts, err := addContext().BalanceAmounts(&tx, posting.Account)
+			if err != nil {
+				fmt.Println("Error balancing transaction:", err)
+				goto AskAmount
+			}
+			posting.Amount, others = amounts[0], amounts[1:]
+			if comment != "" {
+				posting.Amount += " ;" + comment
+			}
 		}
 
-		// Store previous state for potential revert
-		info, err := os.Stat(currentFile)
-		prevSize := int64(0)
-		if err == nil {
-			prevSize = info.Size()
+		tx.Lines = append(tx.Lines, posting)
+		// every other leftover commodity gets a posting of its own
+		for _, other := range others {
+			tx.Lines = append(tx.Lines, entry.Line{
+				Type:    entry.LinePosting,
+				Status:  posting.Status,
+				Account: posting.Account,
+				Amount:  other,
+			})
 		}
+	}
 
-		// Save transaction to file
-		f, err := os.OpenFile(currentFile, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Printf("Error opening file: %v\n", err)
-			return
+	askDocument()
+	return tx, true
+}
+
+// askDocument asks for a receipt to attach, unless --doc gave one.
+func askDocument() {
+	if addDoc == "" {
+		addDoc = AskCompleting("Document?", completePath)
+	}
+}
+
+// commitTransaction formats the transaction, appends it to currentFile and
+// validates the journal with hledger check, reverting the entry on failure
+// if the user (or, for scripts, always) agrees. It returns the exit code.
+func commitTransaction(tx entry.Transaction, interactive bool) int {
+	// Attach the document with a doc tag, it is copied once the entry is
+	// written and kept
+	doc, src := "", cleanPath(addDoc)
+	for i, line := range tx.Lines {
+		if src == "" || line.Type != entry.LineTransaction {
+			continue
 		}
-		defer f.Close()
-		// Write the content
-		if _, err := f.WriteString(content); err != nil {
-			fmt.Printf("Error writing to file: %v\n", err)
-			return
+		var err error
+		doc, err = documentName(src, line.Date)
+		if err != nil {
+			fmt.Println("Error attaching document:", err)
+			return exitRejected
 		}
-		fmt.Println("Validating transaction...")
-		f.Close()
+		tx.Lines[i].Tags = append(tx.Lines[i].Tags, entry.Tag{Name: "doc", Value: doc})
+	}
 
-		// Validate changes
-		cmdArgs := []string{"check", "-f", currentFile}
-		out, err := exec.Command("hledger", cmdArgs...).CombinedOutput()
-		if err != nil {
-			fmt.Println("Error validating ledger:")
-			fmt.Println(string(out))
-
-			if Confirm("Do you want to revert the changes?") {
-				revertErr := os.Truncate(currentFile, prevSize)
-				if revertErr != nil {
-					fmt.Printf("Error reverting changes: %v\n", revertErr)
-				} else {
-					fmt.Println("Changes reverted.")
-				}
-				return
-			} else {
-				fmt.Println("Changes kept despite validation errors.")
+	content := "\n" + addContext().Formatter().Format(tx)
+
+	// Display the collected transaction
+	fmt.Printf("\nAdding this following transaction to %s:\n", currentFile)
+	fmt.Printf("%s\n", content)
+
+	// Confirm before writing
+	if interactive && !Confirm("Is this correct") {
+		fmt.Println("Transaction discarded.")
+		return exitRejected
+	}
+
+	// Save transaction to file, logged so teka undo can take it back later
+	written, err := journalfile.Append(currentFile, content)
+	if errors.Is(err, journalfile.ErrNotLogged) {
+		fmt.Printf("Warning: %v, teka undo won't know about it\n", err)
+	} else if err != nil {
+		fmt.Printf("Error writing to file: %v\n", err)
+		return exitFailed
+	}
+	fmt.Println("Validating transaction...")
+
+	// Validate changes
+	if err := addContext().Check(context.Background()); err != nil {
+		fmt.Println("Error validating ledger:")
+		fmt.Println(err)
+
+		// scripts can't answer, so their changes are always reverted
+		if !interactive || Confirm("Do you want to revert the changes?") {
+			// only our own entry is taken out, and only if it is unchanged
+			revertErr := journalfile.Remove(written)
+			if revertErr != nil {
+				fmt.Printf("Error reverting changes: %v\n", revertErr)
+				return exitFailed
 			}
-		} else {
-			fmt.Println("Transaction added successfully.")
+			fmt.Println("Changes reverted.")
+			return exitReverted
 		}
-	},
+		fmt.Println("Changes kept despite validation errors.")
+		if !attachDocument(src, doc, written) {
+			return exitFailed
+		}
+		return exitKept
+	}
+	if !attachDocument(src, doc, written) {
+		return exitFailed
+	}
+	fmt.Println("Transaction added successfully.")
+	return exitAdded
 }
 
+var editor = prompt.NewEditor(os.Stdin, os.Stdout)
+
 // Prompt for data
 func Ask(question string) string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(question + " ")
-	input, _ := reader.ReadString('\n')
-	return strings.TrimSpace(input)
+	return AskCompleting(question, nil)
+}
+
+// AskCompleting prompts for data with tab completion. Ctrl-C aborts teka.
+func AskCompleting(question string, complete prompt.Completer) string {
+	answer, err := editor.Ask(question, complete)
+	if errors.Is(err, prompt.ErrInterrupted) {
+		fmt.Println("Abort.")
+		os.Exit(exitRejected)
+	}
+	return answer
+}
+
+// completeAccount completes account names from the main journal, keeping
+// the $ of a currency conversion.
+func completeAccount(line string) []string {
+	mark := ""
+	if strings.HasPrefix(line, "$") {
+		mark, line = "$", line[1:]
+	}
+	matches := prompt.Match(line, journalAccounts())
+	for i := range matches {
+		matches[i] = mark + matches[i]
+	}
+	return matches
+}
+
+// completeNote completes descriptions from the main journal.
+func completeNote(line string) []string {
+	return prompt.Match(line, journalDescriptions())
+}
+
+// journalAccounts are the accounts of the main journal, read once.
+var journalAccounts = sync.OnceValue(func() []string {
+	j := mainJournal()
+	if j == nil {
+		return nil
+	}
+	return j.AccountNames()
+})
+
+// journalDescriptions are the descriptions in the main journal, most
+// recent first, read once.
+var journalDescriptions = sync.OnceValue(func() []string {
+	j := mainJournal()
+	if j == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var descriptions []string
+	for i := len(j.Transactions) - 1; i >= 0; i-- {
+		d := j.Transactions[i].Description
+		if d != "" && !seen[d] {
+			seen[d] = true
+			descriptions = append(descriptions, d)
+		}
+	}
+	return descriptions
+})
+
+// askDefault prompts with a default answer, taken when nothing is typed.
+// "-" answers with nothing instead.
+func askDefault(question, def string, complete prompt.Completer) string {
+	if def == "" {
+		return AskCompleting(question, complete)
+	}
+	answer := AskCompleting(question+" ["+def+"]", complete)
+	switch answer {
+	case "":
+		return def
+	case "-":
+		return ""
+	}
+	return answer
+}
+
+// previousPostings returns the postings of the most recent transaction in
+// the main journal whose description or note is note, as lines to suggest.
+// Amounts hledger would infer and balance assertions are left out.
+func previousPostings(note string) []entry.Line {
+	j := mainJournal()
+	if j == nil || note == "" {
+		return nil
+	}
+
+	var latest *journal.Transaction
+	for i, tx := range j.Transactions {
+		if tx.Description != note && tx.Note() != note {
+			continue
+		}
+		if latest == nil || !tx.Date.Before(latest.Date) {
+			latest = &j.Transactions[i]
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+
+	var lines []entry.Line
+	for _, p := range latest.Postings {
+		account := p.Account
+		switch p.Type {
+		case journal.VirtualPosting:
+			account = "(" + account + ")"
+		case journal.BalancedVirtualPosting:
+			account = "[" + account + "]"
+		}
+		if p.Status != journal.Unmarked {
+			account = string(p.Status) + " " + account
+		}
+		amount := ""
+		if !p.Inferred && len(p.Amounts) == 1 {
+			amount = p.Amounts[0].String()
+		}
+		lines = append(lines, entry.Line{Type: entry.LinePosting, Account: account, Amount: amount})
+	}
+	return lines
 }
 
 // Yes no confirm prompt
@@ -280,43 +501,28 @@ func Confirm(question string) bool {
 	return false
 }
 
-// Parse shortcut dates
-func ParseDate(input string) (string, error) {
-	today := time.Now()
-	var d time.Time
-
-	switch input {
-	case ".":
-		d = today
-	case ".y":
-		d = today.AddDate(0, 0, -1)
-	case ".t":
-		d = today.AddDate(0, 0, 1)
-	default:
-		parsed, err := time.Parse("2006-01-02", input)
-		if err != nil {
-			return "", fmt.Errorf("invalid date format, please use YYYY-MM-DD or . for today, .y for yesterday, .t for tomorrow")
-		}
-		d = parsed
-	}
-	return d.Format("2006-01-02"), nil
-}
-
 func SearchRecords(mode, searchTerm string) (string, error) {
 	mainFile, err := fileselector.GetMainFile(fileArg, mainFileArg)
 	if err != nil {
 		return "", err
 	}
 
-	cmdArgs := []string{mode, searchTerm, "-f", mainFile}
+	var results []string
+	if config.UseNativeBackend() {
+		results, err = searchJournal(mode, searchTerm, mainFile)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		cmdArgs := []string{mode, searchTerm, "-f", mainFile}
 
-	out, err := exec.Command("hledger", cmdArgs...).CombinedOutput()
-	if err != nil {
-		fmt.Println(string(out))
-		return "", err
-	}
+		out, _, err := hledgerRunner().Run(context.Background(), cmdArgs)
+		if err != nil {
+			return "", err
+		}
 
-	results := strings.Split(strings.TrimSpace(string(out)), "\n")
+		results = strings.Split(strings.TrimSpace(string(out)), "\n")
+	}
 	if len(results) == 0 || (len(results) == 1 && results[0] == "") {
 		fmt.Println("No " + mode + " found.")
 		return "", nil
@@ -329,10 +535,7 @@ func SearchRecords(mode, searchTerm string) (string, error) {
 	}
 
 	// Ask user to choose
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Select " + strings.TrimSuffix(mode, "s") + " (type index or full name): ")
-	choice, _ := reader.ReadString('\n')
-	choice = strings.TrimSpace(choice)
+	choice := Ask("Select " + strings.TrimSuffix(mode, "s") + " (type index or full name):")
 
 	// Try parsing as index
 	num, err := strconv.Atoi(choice)
@@ -346,20 +549,51 @@ func SearchRecords(mode, searchTerm string) (string, error) {
 	return choice, nil
 }
 
+// searchJournal answers `hledger accounts TERM` and `hledger notes TERM`
+// with the native journal parser.
+func searchJournal(mode, searchTerm, file string) ([]string, error) {
+	j, err := journal.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := journal.ParseQuery(strings.Fields(searchTerm))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []string
+	switch mode {
+	case "accounts":
+		for _, name := range j.AccountNames() {
+			if f.MatchAccount(name) {
+				results = append(results, name)
+			}
+		}
+	case "notes":
+		seen := map[string]bool{}
+		for _, tx := range j.Select(f) {
+			if note := tx.Note(); !seen[note] {
+				seen[note] = true
+				results = append(results, note)
+			}
+		}
+		sort.Strings(results)
+	}
+	return results, nil
+}
+
 // creates postings for currency conversion transactions
-func convertCurrencies(tx *Transaction, foreignAccount string) error {
+func convertCurrencies(tx *entry.Transaction, foreignAccount string) error {
 	foreignAccount = strings.TrimPrefix(foreignAccount, "$")
 AskForeignAmount:
 	foreignAmount := Ask("Amount?")
-	foreignAmountValue, err := strconv.ParseFloat(strings.Split(foreignAmount, " ")[0], 64)
-	if err != nil {
+	if _, err := addContext().ParseAmount(foreignAmount); err != nil {
 		fmt.Println("Invalid amount: ", err)
 		goto AskForeignAmount
 	}
-	foreignCurrency := strings.Split(foreignAmount, " ")[1]
 
 AskLocalAccount:
-	localAccount := Ask("Account?")
+	localAccount := AskCompleting("Account?", completeAccount)
 	if localAccount == "" {
 		fmt.Println("Local account must be specified when converting currencies.")
 		goto AskLocalAccount
@@ -385,8 +619,8 @@ AskLocalAccount:
 	// Comment
 	if localAccount == ";" || localAccount == "#" {
 		comment := Ask("Comment?")
-		tx.Lines = append(tx.Lines, Line{
-			Type:   LineComment,
+		tx.Lines = append(tx.Lines, entry.Line{
+			Type:   entry.LineComment,
 			Text:   comment,
 			Indent: localAccount == ";",
 		})
@@ -395,156 +629,58 @@ AskLocalAccount:
 
 AskLocalAmount:
 	localAmount := Ask("Amount?")
-	localAmountValue, err := strconv.ParseFloat(strings.Split(localAmount, " ")[0], 64)
-	if err != nil {
+	if _, err := addContext().ParseAmount(localAmount); err != nil {
 		fmt.Println("Invalid amount:", err)
 		goto AskLocalAmount
 	}
-	localCurrency := strings.Split(localAmount, " ")[1]
-
-	// Local to foreign conversion
-	if foreignAmountValue >= 0 {
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: foreignAccount,
-			Amount:  fmt.Sprintf("%s @@ %g %s", foreignAmount, localAmountValue*(-1), localCurrency),
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: localAccount,
-			Amount:  localAmount,
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: config.Cfg.Accounts.ConversionAccount,
-			Amount:  fmt.Sprintf("%g %s", foreignAmountValue*(-1), foreignCurrency),
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: config.Cfg.Accounts.ConversionAccount,
-			Amount:  fmt.Sprintf("%g %s", localAmountValue*(-1), localCurrency),
-		})
-	} else {
-		// Foreign to local conversion
-		totalForeignBalance, totalForeignValue, err := getForeignBalance(foreignAccount)
-		if err != nil {
-			return err
-		}
 
-		var convertedForeignValue float64
-		// convert full balance without rounding error
-		if -foreignAmountValue == totalForeignBalance {
-			convertedForeignValue = totalForeignValue
-		} else { // partial amount conversion
-			weightedAverageCost := totalForeignValue / totalForeignBalance
-			convertedForeignValue = (-foreignAmountValue) * weightedAverageCost
-		}
-
-		gainLoss := localAmountValue - convertedForeignValue
-		gainLossAcc := config.Cfg.Accounts.FXLossAccount
-		if gainLoss >= 0 {
-			gainLossAcc = config.Cfg.Accounts.FXGainAccount
-		}
-
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: foreignAccount,
-			Amount:  fmt.Sprintf("%s @@ %g %s", foreignAmount, convertedForeignValue, localCurrency),
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: localAccount,
-			Amount:  localAmount,
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: gainLossAcc,
-			Amount:  fmt.Sprintf("%g %s", -gainLoss, localCurrency),
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: config.Cfg.Accounts.ConversionAccount,
-			Amount:  fmt.Sprintf("%g %s", -convertedForeignValue, localCurrency),
-		})
-		tx.Lines = append(tx.Lines, Line{
-			Type:    LinePosting,
-			Account: config.Cfg.Accounts.ConversionAccount,
-			Amount:  fmt.Sprintf("%g %s", -foreignAmountValue, foreignCurrency),
-		})
+	lines, err := addContext().Convert(context.Background(), addtx.Conversion{
+		ForeignAccount: foreignAccount,
+		ForeignAmount:  foreignAmount,
+		LocalAccount:   localAccount,
+		LocalAmount:    localAmount,
+	})
+	if err != nil {
+		return err
 	}
+	tx.Lines = append(tx.Lines, lines...)
 	return nil
 }
 
-func getForeignBalance(account string) (float64, float64, error) {
-	mainFile, err := fileselector.GetMainFile(fileArg, mainFileArg)
-	if err != nil {
-		return 0, 0, err
+// addContext is the add pipeline for the file the entry goes to.
+func addContext() *addtx.Context {
+	mainFile, _ := fileselector.GetMainFile(fileArg, mainFileArg)
+	return &addtx.Context{
+		File:     currentFile,
+		MainFile: mainFile,
+		Journal:  mainJournal(),
+		Runner:   hledgerRunner(),
 	}
+}
 
-	// get balance in foreign currency
-	// hledger bal account --file file
-	balCmd := exec.Command("hledger", "bal", account, "-f", currentFile, "--no-total")
-	balOut, err := balCmd.Output()
+var hledgerRunner = sync.OnceValue(func() hledger.Runner {
+	return hledger.NewExecRunner(
+		config.Cfg.Hledger.Path,
+		time.Duration(config.Cfg.Hledger.TimeoutSeconds)*time.Second,
+		config.Cfg.Hledger.MaxProcesses,
+	)
+})
+
+// mainJournal is the main journal read with the native parser, for
+// commodity styles and account search. It is nil when the journal can't
+// be read, which is said once since those features are then missing.
+var mainJournal = sync.OnceValue(func() *journal.Journal {
+	mainFile, err := fileselector.GetMainFile(fileArg, mainFileArg)
 	if err != nil {
-		return 0, 0, err
+		return nil
 	}
-	balFields := strings.Fields(string(balOut))
-	var balance float64
-	if len(balFields) > 0 {
-		balance, _ = strconv.ParseFloat(balFields[0], 64)
-	} else {
-		fmt.Println(account, "has no balance.")
-		return 0, 0, errors.New("can not calculate gain from zero balance")
-	}
-
-	// get value of foreign balance in local currency
-	// hledger bal account --file file --value=then --cost
-	valCmd := exec.Command("hledger", "bal", account, "-f", mainFile, "--no-total", "--value=then,"+config.Cfg.BaseCurrency, "--cost")
-	valOut, err := valCmd.Output()
+	j, err := journal.Parse(mainFile)
 	if err != nil {
-		return balance, 0, err
-	}
-	valFields := strings.Fields(string(valOut))
-	var value float64
-	if len(valFields) > 0 {
-		value, _ = strconv.ParseFloat(valFields[0], 64)
-	}
-
-	return balance, value, nil
-}
-
-func calculateBalanceAmount(tx *Transaction) (string, error) {
-	var total float64
-	var currency string
-
-	for _, l := range tx.Lines {
-		if l.Type != LinePosting {
-			continue
-		}
-		if l.Amount == "" {
-			return "", errors.New("can not balance if postings are missing amount")
-		}
-		parts := strings.Fields(l.Amount)
-		if len(parts) < 2 {
-			return "", errors.New("invalid amount format. Only acceptable format is 1000.00 CUR")
-		}
-		val, err := strconv.ParseFloat(parts[0], 64)
-		if err != nil {
-			return "", errors.New("invalid number in " + l.Amount)
-		}
-		if currency == "" {
-			currency = parts[1]
-		}
-		if parts[1] != currency {
-			return "", errors.New("mixed currencies not supported for auto-balance")
-		}
-		total += val
-	}
-	if currency == "" {
-		return "", errors.New("no amounts to balance")
+		fmt.Printf("Warning: %v, account completion, suggestions and amount styles are off\n", err)
+		return nil
 	}
-	return fmt.Sprintf("%g %s", -total, currency), nil
-}
+	return j
+})
 
 func init() {
 	rootCmd.AddCommand(addCmd)
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/azbashar/teka/internal/entry"
+	"github.com/azbashar/teka/internal/fileselector"
+)
+
+var (
+	addDate     string
+	addDesc     string
+	addStatus   string
+	addCode     string
+	addPayee    string
+	addTags     []string
+	addPostings []string
+	addStdin    bool
+)
+
+// scriptedEntry is the JSON teka add --stdin accepts.
+type scriptedEntry struct {
+	Date        string   `json:"date"`
+	Status      string   `json:"status"`
+	Code        string   `json:"code"`
+	Payee       string   `json:"payee"`
+	Description string   `json:"description"`
+	Comment     string   `json:"comment"`
+	Tags        []string `json:"tags"`
+	Postings    []struct {
+		Status  string   `json:"status"`
+		Account string   `json:"account"`
+		Amount  string   `json:"amount"`
+		Comment string   `json:"comment"`
+		Tags    []string `json:"tags"`
+	} `json:"postings"`
+}
+
+// scriptedTransaction builds the transaction from the add flags or stdin
+// and picks the file it goes to.
+func scriptedTransaction() (entry.Transaction, error) {
+	var tx entry.Transaction
+	var err error
+	if addStdin {
+		tx, err = transactionFromStdin()
+	} else {
+		tx, err = transactionFromFlags()
+	}
+	if err != nil {
+		return tx, err
+	}
+
+	// resolve date shortcuts and check what we got
+	var date string
+	postings := 0
+	for i, line := range tx.Lines {
+		switch line.Type {
+		case entry.LineTransaction:
+			if line.Date == "" {
+				line.Date = "."
+			}
+			date, err = ParseDate(line.Date)
+			if err != nil {
+				return tx, err
+			}
+			tx.Lines[i].Date = date
+		case entry.LinePosting:
+			if line.Account == "" {
+				return tx, errors.New("posting without an account")
+			}
+			postings++
+		}
+	}
+	if postings == 0 {
+		return tx, errors.New("transaction has no postings")
+	}
+
+	currentFile, err = fileselector.GetCurrentFile(primaryDate(date), fileArg)
+	if err != nil {
+		return tx, err
+	}
+	return tx, nil
+}
+
+func transactionFromFlags() (entry.Transaction, error) {
+	header := entry.ParseHeader(addDate, addDesc)
+	if err := setHeader(&header, addStatus, addCode, addPayee, addTags); err != nil {
+		return entry.Transaction{}, err
+	}
+	tx := entry.Transaction{Lines: []entry.Line{header}}
+	for _, p := range addPostings {
+		account, amount := splitPostingFlag(p)
+		tx.Lines = append(tx.Lines, entry.ParsePosting(account, amount))
+	}
+	return tx, nil
+}
+
+// setHeader sets the status, code, payee and tags given apart from the
+// description, when they are given.
+func setHeader(line *entry.Line, status, code, payee string, tags []string) error {
+	var err error
+	if status != "" {
+		if line.Status, err = entry.ParseStatus(status); err != nil {
+			return err
+		}
+	}
+	if code != "" {
+		line.Code = code
+	}
+	if payee != "" {
+		line.Payee = payee
+	}
+	line.Tags = append(line.Tags, parseTags(tags)...)
+	return nil
+}
+
+// parseTags reads NAME:VALUE tags.
+func parseTags(tags []string) []entry.Tag {
+	var out []entry.Tag
+	for _, t := range tags {
+		name, value, _ := strings.Cut(t, ":")
+		out = append(out, entry.Tag{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return out
+}
+
+// splitPostingFlag splits "account amount". Two spaces end the account like
+// in a journal; otherwise the account ends at the first space after which
+// the rest reads as an amount, so account names may contain spaces.
+func splitPostingFlag(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "  ") || strings.Contains(s, "\t") {
+		return entry.SplitPosting(s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			continue
+		}
+		amount, _, _ := strings.Cut(entry.ParsePosting("", s[i+1:]).Amount, ";")
+		amount = strings.TrimSpace(amount)
+		if amount == "" {
+			continue
+		}
+		if _, _, err := mainJournal().ParsePostingAmount(amount); err == nil {
+			return s[:i], strings.TrimSpace(s[i+1:])
+		}
+	}
+	return s, ""
+}
+
+func transactionFromStdin() (entry.Transaction, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return entry.Transaction{}, err
+	}
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, "{") {
+		return entry.Parse(text)
+	}
+
+	var in scriptedEntry
+	if err := json.Unmarshal([]byte(text), &in); err != nil {
+		return entry.Transaction{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	note := in.Description
+	if in.Comment != "" {
+		note += " ; " + in.Comment
+	}
+	header := entry.Line{Type: entry.LineTransaction, Date: in.Date, Note: note}
+	if err := setHeader(&header, in.Status, in.Code, in.Payee, in.Tags); err != nil {
+		return entry.Transaction{}, err
+	}
+	tx := entry.Transaction{Lines: []entry.Line{header}}
+	for _, p := range in.Postings {
+		status, err := entry.ParseStatus(p.Status)
+		if err != nil {
+			return entry.Transaction{}, err
+		}
+		amount := p.Amount
+		if p.Comment != "" {
+			amount += " ; " + p.Comment
+		}
+		tx.Lines = append(tx.Lines, entry.Line{
+			Type:    entry.LinePosting,
+			Status:  status,
+			Account: p.Account,
+			Amount:  amount,
+			Tags:    parseTags(p.Tags),
+		})
+	}
+	return tx, nil
+}
+
+func init() {
+	addCmd.Flags().StringVar(&addDate, "date", "", "Date of the transaction (YYYY-MM-DD or a date shortcut, default today)")
+	addCmd.Flags().StringVar(&addDesc, "desc", "", "Description of the transaction")
+	addCmd.Flags().StringVar(&addStatus, "status", "", "Status of the transaction: cleared, pending or unmarked")
+	addCmd.Flags().StringVar(&addCode, "code", "", "Code of the transaction, like a check number")
+	addCmd.Flags().StringVar(&addPayee, "payee", "", "Payee, written before the description as PAYEE | DESCRIPTION")
+	addCmd.Flags().StringArrayVar(&addTags, "tag", nil, "Transaction tag as NAME:VALUE, repeat for each tag")
+	addCmd.Flags().StringArrayVar(&addPostings, "posting", nil, `Posting as "account amount", repeat for each posting`)
+	addCmd.Flags().BoolVar(&addStdin, "stdin", false, "Read the transaction from stdin as JSON or journal text")
+}
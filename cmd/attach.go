@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/azbashar/teka/internal/docs"
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/writelog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addDoc      string
+	attachEntry int
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach RECEIPT",
+	Short: "Attach a receipt or other document to a transaction Teka wrote",
+	Long: `Attach a receipt or other document to the last transaction Teka wrote,
+or an earlier one with --entry (1 is the latest, as listed by teka log).
+
+The file is copied into the docs directory under the ledger root, named by
+the transaction date and its content hash, and the transaction gets a
+doc: tag pointing to the copy.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fileArg = rootCmd.Flag("file").Value.String()
+		mainFileArg = rootCmd.Flag("mainfile").Value.String()
+
+		entries, err := writelog.Read()
+		if err != nil {
+			fmt.Println("Error reading write log:", err)
+			os.Exit(1)
+		}
+		if attachEntry < 1 || attachEntry > len(entries) {
+			fmt.Printf("No entry %d in the write log, see teka log.\n", attachEntry)
+			os.Exit(1)
+		}
+		e := entries[len(entries)-attachEntry]
+
+		content, err := journalfile.Content(e)
+		if errors.Is(err, writelog.ErrChanged) {
+			fmt.Printf("%s was changed in %s since it was written, attach the document by hand.\n", e.Summary, e.File)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Println("Error reading entry:", err)
+			os.Exit(1)
+		}
+
+		src := cleanPath(args[0])
+		name, err := documentName(src, entryDate(content))
+		if err == nil {
+			err = saveDocument(src, name)
+		}
+		if err != nil {
+			fmt.Println("Error saving document:", err)
+			os.Exit(1)
+		}
+		if _, err := journalfile.Replace(e, withDocTag(content, name)); err != nil {
+			fmt.Println("Error writing doc tag:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Attached %s to %s.\n", name, e.Summary)
+	},
+}
+
+// documentName is the doc tag value for src attached to a transaction on
+// date.
+func documentName(src, date string) (string, error) {
+	return docs.Name(src, primaryDate(date))
+}
+
+// saveDocument copies a document into the documents directory as name.
+func saveDocument(src, name string) error {
+	root, err := fileselector.GetLedgerRoot(fileArg, mainFileArg)
+	if err != nil {
+		return err
+	}
+	return docs.Save(root, src, name)
+}
+
+// attachDocument copies the document of an entry that was written and
+// kept. When that fails the entry is taken out again, so it doesn't point
+// at a document that isn't there.
+func attachDocument(src, doc string, written writelog.Entry) bool {
+	if doc == "" {
+		return true
+	}
+	err := saveDocument(src, doc)
+	if err == nil {
+		return true
+	}
+	fmt.Printf("Error saving document: %v\n", err)
+	if err := journalfile.Remove(written); err != nil {
+		fmt.Printf("Error reverting changes: %v\n", err)
+	} else {
+		fmt.Println("Changes reverted.")
+	}
+	return false
+}
+
+// cleanPath undoes the quoting and ~ a path typed or dropped into the
+// terminal comes with.
+func cleanPath(p string) string {
+	p = strings.TrimSpace(p)
+	if len(p) >= 2 && (p[0] == '\'' || p[0] == '"') && p[len(p)-1] == p[0] {
+		p = p[1 : len(p)-1]
+	} else {
+		p = strings.ReplaceAll(p, `\ `, " ")
+	}
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, rest)
+		}
+	}
+	return p
+}
+
+// completePath completes file names at the document prompt.
+func completePath(line string) []string {
+	matches, _ := filepath.Glob(cleanPath(line) + "*")
+	for i, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			matches[i] = m + string(filepath.Separator)
+		}
+	}
+	return matches
+}
+
+// docTag is a doc: tag in a comment, up to the next comma. Like other
+// tags, its name starts the comment or follows a space or comma, so
+// nodoc: is not one.
+var docTag = regexp.MustCompile(`(^|[\s,])doc:[^,\n]*`)
+
+// entryDate is the date of the transaction in an entry's text.
+func entryDate(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" || strings.ContainsAny(line[:1], " \t;#") {
+			continue
+		}
+		date, _, _ := strings.Cut(line, " ")
+		return date
+	}
+	return ""
+}
+
+// withDocTag sets the doc tag on the transaction header in an entry's
+// text, replacing one that is there.
+func withDocTag(content, name string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if line == "" || strings.ContainsAny(line[:1], " \t;#") {
+			continue
+		}
+		// tags are only in the comment, not in the description before it
+		head, comment, hasComment := strings.Cut(line, ";")
+		switch {
+		case docTag.MatchString(comment):
+			tag := "${1}doc:" + strings.ReplaceAll(name, "$", "$$")
+			lines[i] = head + ";" + docTag.ReplaceAllString(comment, tag)
+		case hasComment:
+			lines[i] = line + ", doc:" + name
+		default:
+			lines[i] = line + "  ; doc:" + name
+		}
+		return strings.Join(lines, "\n")
+	}
+	return content
+}
+
+func init() {
+	attachCmd.Flags().IntVarP(&attachEntry, "entry", "n", 1, "Which write to attach to, 1 is the latest")
+	addCmd.Flags().StringVar(&addDoc, "doc", "", "Attach a receipt or other document to the transaction")
+	rootCmd.AddCommand(attachCmd)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// .-3, .+1m, .-2w
+	relativeDate = regexp.MustCompile(`^\.([+-]\d+)([dwmy]?)$`)
+	// 15, 03-15, 2025-03-15, with - / or . between the parts
+	partialDate = regexp.MustCompile(`^(?:(?:(\d{4})[-/.])?(\d{1,2})[-/.])?(\d{1,2})$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+const dateHelp = `use YYYY-MM-DD, MM-DD, DD, . for today, .y for yesterday, .t for tomorrow, ` +
+	`.-3 or .+1w/m/y for days, weeks, months or years from today, or a weekday like mon, last fri or next tue`
+
+// Parse shortcut dates. A secondary date can follow after =, as in
+// 2025-01-01=01-03, where shortcuts count from the first date; the result
+// is then "DATE=DATE2".
+func ParseDate(input string) (string, error) {
+	primary, secondary, hasSecondary := strings.Cut(strings.TrimSpace(input), "=")
+	d, err := parseDate(primary, time.Now())
+	if err != nil {
+		return "", err
+	}
+	date := d.Format("2006-01-02")
+	if !hasSecondary {
+		return date, nil
+	}
+	// the secondary date is read relative to the primary one
+	d2, err := parseDate(secondary, d)
+	if err != nil {
+		return "", fmt.Errorf("secondary date: %w", err)
+	}
+	return date + "=" + d2.Format("2006-01-02"), nil
+}
+
+// primaryDate is the date without the secondary one.
+func primaryDate(date string) string {
+	primary, _, _ := strings.Cut(date, "=")
+	return primary
+}
+
+// describeDate shows a parsed date with its weekday, to confirm what a
+// shortcut resolved to.
+func describeDate(date string) string {
+	parts := strings.Split(date, "=")
+	for i, part := range parts {
+		if d, err := time.Parse("2006-01-02", part); err == nil {
+			parts[i] = d.Format("2006-01-02 (Mon)")
+		}
+	}
+	return strings.Join(parts, " = ")
+}
+
+func parseDate(input string, now time.Time) (time.Time, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	switch input {
+	case ".", "today":
+		return today, nil
+	case ".y", "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case ".t", "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	if m := relativeDate.FindStringSubmatch(input); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "w":
+			return today.AddDate(0, 0, 7*n), nil
+		case "m":
+			return addMonths(today, n), nil
+		case "y":
+			return addMonths(today, 12*n), nil
+		}
+		return today.AddDate(0, 0, n), nil
+	}
+
+	// weekdays: the latest one up to today, or the one before or after
+	// today with last and next
+	which, name, ok := strings.Cut(input, " ")
+	if !ok {
+		which, name = "", input
+	}
+	if day, ok := weekdays[strings.TrimSpace(name)]; ok {
+		back := (int(today.Weekday()) - int(day) + 7) % 7
+		switch which {
+		case "":
+			return today.AddDate(0, 0, -back), nil
+		case "last":
+			if back == 0 {
+				back = 7
+			}
+			return today.AddDate(0, 0, -back), nil
+		case "next":
+			return today.AddDate(0, 0, 7-back), nil
+		}
+	}
+
+	if m := partialDate.FindStringSubmatch(input); m != nil {
+		year, month := today.Year(), int(today.Month())
+		if m[1] != "" {
+			year, _ = strconv.Atoi(m[1])
+		}
+		if m[2] != "" {
+			month, _ = strconv.Atoi(m[2])
+		}
+		day, _ := strconv.Atoi(m[3])
+		d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+		// time.Date would roll 02-30 over into March
+		if d.Day() != day || int(d.Month()) != month {
+			return time.Time{}, fmt.Errorf("invalid date %s", input)
+		}
+		return d, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date format, please %s", dateHelp)
+}
+
+// addMonths moves a date by n months, keeping the day but clamping it to
+// the end of a shorter month like hledger does: 01-31 +1m is 02-28, not
+// the 3rd of March AddDate would give.
+func addMonths(d time.Time, n int) time.Time {
+	first := time.Date(d.Year(), d.Month()+time.Month(n), 1, 0, 0, 0, 0, d.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(d.Day(), last)-1)
+}
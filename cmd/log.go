@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/azbashar/teka/internal/writelog"
+	"github.com/spf13/cobra"
+)
+
+var logCount int
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "List the entries Teka wrote recently",
+	Long: `List the entries Teka wrote recently, newest first, with the file and
+byte offset they were written at. Entries marked "changed" were edited or
+moved since and can't be undone.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := writelog.Read()
+		if err != nil {
+			fmt.Println("Error reading write log:", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Teka hasn't written anything yet.")
+			return
+		}
+		for i := len(entries) - 1; i >= 0 && i >= len(entries)-logCount; i-- {
+			fmt.Println(describeWrite(entries[i]))
+		}
+	},
+}
+
+// describeWrite is a one line description of a logged write.
+func describeWrite(e writelog.Entry) string {
+	s := fmt.Sprintf("%s  %.8s  %s@%d  %s", e.Time.Local().Format("2006-01-02 15:04"), e.Hash, e.File, e.Offset, e.Summary)
+	if writelog.Check(e) != nil {
+		s += "  (changed)"
+	}
+	return s
+}
+
+func init() {
+	logCmd.Flags().IntVarP(&logCount, "number", "n", 10, "Number of writes to list")
+	rootCmd.AddCommand(logCmd)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/entry"
+)
+
+var addTemplate, addSaveTemplate string
+
+// placeholder is a {name} in a template.
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func findTemplate(name string) *config.Template {
+	for i, t := range config.Cfg.Templates {
+		if t.Name == name {
+			return &config.Cfg.Templates[i]
+		}
+	}
+	return nil
+}
+
+// templateLines turns a template into transaction lines, asking for each
+// placeholder once, in the order they appear.
+func templateLines(t config.Template, date string) []entry.Line {
+	values := map[string]string{}
+	fill := func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[1 : len(m)-1]
+			if _, ok := values[name]; !ok {
+				values[name] = Ask(name + "?")
+			}
+			return values[name]
+		})
+	}
+	withComment := func(s, comment string) string {
+		if comment == "" {
+			return s
+		}
+		return s + " ; " + comment
+	}
+
+	lines := []entry.Line{entry.ParseHeader(date, withComment(fill(t.Note), fill(t.Comment)))}
+	for _, p := range t.Postings {
+		lines = append(lines, entry.ParsePosting(fill(p.Account), withComment(fill(p.Amount), fill(p.Comment))))
+	}
+	return lines
+}
+
+// saveTemplate stores the transaction as a template with the given name,
+// replacing a template of the same name.
+func saveTemplate(name string, tx entry.Transaction) error {
+	t := config.Template{Name: name}
+	for _, line := range tx.Lines {
+		switch line.Type {
+		case entry.LineTransaction:
+			note, comment, _ := strings.Cut(line.TypedNote(), ";")
+			t.Note, t.Comment = strings.TrimSpace(note), strings.TrimSpace(comment)
+		case entry.LinePosting:
+			account, amount := line.TypedPosting()
+			amount, comment, _ := strings.Cut(amount, ";")
+			t.Postings = append(t.Postings, config.TemplatePosting{
+				Account: account,
+				Amount:  strings.TrimSpace(amount),
+				Comment: strings.TrimSpace(comment),
+			})
+		}
+	}
+
+	if existing := findTemplate(name); existing != nil {
+		*existing = t
+	} else {
+		config.Cfg.Templates = append(config.Cfg.Templates, t)
+	}
+	configFile, err := config.GetConfigPath()
+	if err != nil {
+		return err
+	}
+	return config.SaveConfig(configFile)
+}
+
+func init() {
+	addCmd.Flags().StringVar(&addTemplate, "template", "", "Fill in the transaction from a template in the config")
+	addCmd.Flags().StringVar(&addSaveTemplate, "save-template", "", "Save the transaction as a template with this name once it is added")
+}
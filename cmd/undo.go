@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/writelog"
+	"github.com/spf13/cobra"
+)
+
+var undoYes bool
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [N]",
+	Short: "Remove the last N entries Teka wrote (default 1)",
+	Long: `Remove the last N entries Teka wrote to your journals, newest first.
+
+An entry is only removed when its bytes are unchanged since Teka wrote it;
+undo stops at the first one that was edited or moved. See teka log for the
+recorded writes.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		n := 1
+		if len(args) == 1 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				fmt.Println("N must be a positive number.")
+				os.Exit(1)
+			}
+		}
+
+		entries, err := writelog.Read()
+		if err != nil {
+			fmt.Println("Error reading write log:", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Nothing to undo.")
+			return
+		}
+		n = min(n, len(entries))
+		undo := entries[len(entries)-n:]
+
+		fmt.Println("Removing these entries:")
+		for i := len(undo) - 1; i >= 0; i-- {
+			fmt.Println("  " + describeWrite(undo[i]))
+		}
+		if !undoYes && !Confirm("Remove them") {
+			fmt.Println("Nothing removed.")
+			return
+		}
+
+		for i := len(undo) - 1; i >= 0; i-- {
+			e := undo[i]
+			if err := journalfile.Remove(e); err != nil {
+				if errors.Is(err, writelog.ErrChanged) {
+					fmt.Printf("Not removing %s: it was changed in %s since it was written.\n", e.Summary, e.File)
+				} else {
+					fmt.Printf("Error removing %s: %v\n", e.Summary, err)
+				}
+				os.Exit(1)
+			}
+			fmt.Println("Removed " + e.Summary + ".")
+		}
+	},
+}
+
+func init() {
+	undoCmd.Flags().BoolVarP(&undoYes, "yes", "y", false, "Don't ask for confirmation")
+	rootCmd.AddCommand(undoCmd)
+}
@@ -7,7 +7,7 @@ import { ScrollArea, ScrollBar } from "@/components/ui/scroll-area";
 import { Toggle } from "@/components/ui/toggle";
 import { ToggleGroup, ToggleGroupItem } from "@/components/ui/toggle-group";
 
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { usePageTitle } from "@/context/PageTitleContext";
 import { formatLocalDate } from "@/lib/utils";
 import { ScaleIcon } from "lucide-react";
@@ -66,6 +66,7 @@ export default function IncomeStatementPage() {
   const [period, setPeriod] = React.useState("");
 
   const [incomeStatementHTML, setIncomeStatementHTML] = React.useState("");
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const data = await getIncomeStatement(
@@ -81,7 +82,7 @@ export default function IncomeStatementPage() {
       setIncomeStatementHTML(data);
     };
     fetchData();
-  }, [range, valueMode, period]);
+  }, [range, valueMode, period, journalVersion]);
 
   return (
     <div>
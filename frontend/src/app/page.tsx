@@ -8,7 +8,7 @@ import {
   TooltipContent,
   TooltipTrigger,
 } from "@/components/ui/tooltip";
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { usePageTitle } from "@/context/PageTitleContext";
 import { formatLocalDate } from "@/lib/utils";
 import { HelpCircle } from "lucide-react";
@@ -42,13 +42,14 @@ export default function Home() {
     }[]
   >([]);
 
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const data = await getAccountBalances(formatLocalDate(range?.to));
       setAccountBalances(data);
     };
     fetchData();
-  }, [range]);
+  }, [range, journalVersion]);
 
   const { setTitle } = usePageTitle();
   React.useEffect(() => {
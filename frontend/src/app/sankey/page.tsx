@@ -15,6 +15,7 @@ import React, { useEffect, useState } from "react";
 import { DateRange } from "react-day-picker";
 import { Sankey, ResponsiveContainer } from "recharts";
 import { toast } from "sonner";
+import { useJournalVersion } from "@/context/ConfigContext";
 
 type SankeyNode = { name: string };
 type SankeyLink = { source: number; target: number; value: number };
@@ -102,6 +103,7 @@ export default function SankeyChart() {
   });
   const [depth, setDepth] = useState("full");
 
+  const journalVersion = useJournalVersion();
   useEffect(() => {
     fetch(
       `http://localhost:8080/api/sankey/?startDate=${formatLocalDate(
@@ -127,7 +129,7 @@ export default function SankeyChart() {
           `Component: SankeyChart, Error fetching data: ${err.message}`
         );
       });
-  }, [range, depth]);
+  }, [range, depth, journalVersion]);
 
   const CustomLink = (props: {
     sourceX: number;
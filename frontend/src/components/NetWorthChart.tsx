@@ -20,19 +20,44 @@ import {
   ChartTooltipContent,
 } from "@/components/ui/chart";
 import { formatLocalDate } from "@/lib/utils";
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 
-type NetWorthData = { date: string; networth: number; currency: string };
+type NetWorthData = {
+  date: string;
+  networth: number;
+  assets: number;
+  liabilities: number;
+  currency: string;
+};
 
-// function to populate chartData from api request with startDate and endDate params. api request will be localhost:8080/api/networth?startDate=..&endDate=..
-async function getNetWorthData(startDate: string, endDate: string) {
+// function to populate chartData from api request with startDate and endDate params. api request will be localhost:8080/api/networth?startDate=..&endDate=..&interval=..
+async function getNetWorthData(
+  startDate: string,
+  endDate: string,
+  interval: string
+) {
   const res = await fetch(
-    `http://localhost:8080/api/networth/?startDate=${startDate}&endDate=${endDate}`
+    `http://localhost:8080/api/networth/?startDate=${startDate}&endDate=${endDate}&interval=${interval}`
   );
   const data = await res.json();
   return data;
 }
 
+// pick a granularity that keeps the number of points reasonable
+function intervalFor(range: DateRange | undefined) {
+  if (!range?.from || !range?.to) {
+    return "weekly";
+  }
+  const days = (range.to.getTime() - range.from.getTime()) / 86400000;
+  if (days <= 92) {
+    return "daily";
+  }
+  if (days <= 2 * 366) {
+    return "weekly";
+  }
+  return "monthly";
+}
+
 const chartConfig = {
   visitors: {
     label: "Visitors",
@@ -41,6 +66,14 @@ const chartConfig = {
     label: "Networth",
     color: "var(--chart-2)",
   },
+  assets: {
+    label: "Assets",
+    color: "var(--chart-1)",
+  },
+  liabilities: {
+    label: "Liabilities",
+    color: "var(--chart-5)",
+  },
 } satisfies ChartConfig;
 
 type NetWorthChartProps = {
@@ -51,16 +84,18 @@ export function NetWorthChart({ range }: NetWorthChartProps) {
   const config = useConfig();
   const [chartData, setChartData] = React.useState<NetWorthData[]>([]);
 
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const data = await getNetWorthData(
         formatLocalDate(range?.from),
-        formatLocalDate(range?.to)
+        formatLocalDate(range?.to),
+        intervalFor(range)
       );
       setChartData(data);
     };
     fetchData();
-  }, [range]);
+  }, [range, journalVersion]);
 
   const filteredData = chartData;
 
@@ -163,6 +198,20 @@ export function NetWorthChart({ range }: NetWorthChartProps) {
               stroke="var(--chart-2)"
               stackId="a"
             />
+            <Area
+              dataKey="assets"
+              type="basis"
+              fillOpacity={0}
+              stroke="var(--chart-1)"
+              strokeDasharray="4 4"
+            />
+            <Area
+              dataKey="liabilities"
+              type="basis"
+              fillOpacity={0}
+              stroke="var(--chart-5)"
+              strokeDasharray="4 4"
+            />
             <ChartLegend content={<ChartLegendContent />} />
           </AreaChart>
         </ChartContainer>
@@ -21,7 +21,7 @@ import {
 } from "@/components/ui/chart";
 import { formatLocalDate } from "@/lib/utils";
 
-import { Config, useConfig } from "@/context/ConfigContext";
+import { Config, useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { toast } from "sonner";
 
 type IncomeStatementBarProps = {
@@ -113,6 +113,7 @@ export function StatementBar({
   const [chartData, setChartData] = React.useState<ChartDataItem[]>([]);
   const [noData, setNoData] = React.useState(false);
 
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const startDate = formatLocalDate(
@@ -158,7 +159,7 @@ export function StatementBar({
         });
     };
     fetchData();
-  }, [range, config, statement]);
+  }, [range, config, statement, journalVersion]);
 
   // Dynamically build chart config depending on statement
   const chartConfig: ChartConfig =
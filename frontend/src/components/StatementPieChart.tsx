@@ -35,7 +35,7 @@ import { BarChartBigIcon, CornerLeftUp, PieChartIcon } from "lucide-react";
 import { Tooltip, TooltipContent, TooltipTrigger } from "./ui/tooltip";
 import { Tabs, TabsList, TabsTrigger } from "./ui/tabs";
 import { TabsContent } from "@radix-ui/react-tabs";
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { toast } from "sonner";
 
 type IncomeStatementData = {
@@ -82,6 +82,7 @@ export function StatementPieChart({
   const [noData, setNoData] = React.useState(false);
   const [account, setAccount] = React.useState<string[]>([rootAccount ?? ""]);
 
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const startDate = formatLocalDate(range?.from);
@@ -139,7 +140,7 @@ export function StatementPieChart({
         });
     };
     fetchData();
-  }, [range, account, config, statement]);
+  }, [range, account, config, statement, journalVersion]);
 
   // rebuild chartConfig whenever chartData changes
   React.useEffect(() => {
@@ -20,7 +20,7 @@ import {
   ChartTooltipContent,
 } from "@/components/ui/chart";
 import { formatLocalDate } from "@/lib/utils";
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { Tooltip, TooltipContent, TooltipTrigger } from "./ui/tooltip";
 import { Button } from "./ui/button";
 import { CornerLeftUp } from "lucide-react";
@@ -63,6 +63,7 @@ export function StatementStackedBar({
   const [noData, setNoData] = React.useState(false);
   const [account, setAccount] = React.useState<string[]>([rootAccount || ""]);
 
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     const fetchData = async () => {
       const startDate = formatLocalDate(
@@ -136,7 +137,7 @@ export function StatementStackedBar({
     };
 
     fetchData();
-  }, [range, account, config, statement]);
+  }, [range, account, config, statement, journalVersion]);
 
   // Build chartConfig dynamically for shadcn legend/colors
   const chartConfig: ChartConfig = accounts.reduce((acc, account, idx) => {
@@ -5,7 +5,7 @@ import { DateRange } from "react-day-picker";
 import { Card, CardContent } from "./ui/card";
 import { Separator } from "./ui/separator";
 import { formatLocalDate } from "@/lib/utils";
-import { useConfig } from "@/context/ConfigContext";
+import { useConfig, useJournalVersion } from "@/context/ConfigContext";
 import { Tooltip, TooltipContent, TooltipTrigger } from "./ui/tooltip";
 import {
   ArrowLeftRight,
@@ -24,6 +24,9 @@ import { Badge } from "./ui/badge";
 import { toast } from "sonner";
 import { Button } from "./ui/button";
 
+// transactions are fetched from the server a page at a time
+const PAGE_SIZE = 15;
+
 type TransactionListProps = {
   range: DateRange | undefined;
   account?: string;
@@ -48,6 +51,13 @@ type Transaction = {
     status: string;
     tags: { key: string; value: string }[];
   }[];
+  source: {
+    id: string;
+    file: string;
+    line: number;
+    endLine: number;
+    hash: string;
+  } | null;
 };
 
 export default function TransactionList({
@@ -56,36 +66,52 @@ export default function TransactionList({
   valueMode,
 }: TransactionListProps) {
   const [transactions, setTransactions] = React.useState<Transaction[]>([]);
+  const [total, setTotal] = React.useState(0);
   const [loading, setLoading] = React.useState(true);
-  const [visibleCount, setVisibleCount] = React.useState(15);
 
+  const fetchPage = React.useCallback(
+    (offset: number) => {
+      const startDate = formatLocalDate(range?.from);
+      const endDate = formatLocalDate(range?.to);
+      const acct = account || "";
+      const value = valueMode || "";
+      return fetch(
+        `http://localhost:8080/api/transactions/?startDate=${startDate}&endDate=${endDate}&valueMode=${value}&account=${acct}&offset=${offset}&limit=${PAGE_SIZE}`
+      )
+        .then((res) => {
+          if (!res.ok) {
+            return res.text().then((body) => {
+              throw new Error(`(${res.status}) ${res.statusText} : ${body}`);
+            });
+          }
+          return res.json();
+        })
+        .catch((err) => {
+          toast.error(`Error fetching data: ${err.message}`);
+          console.error(err);
+        });
+    },
+    [range, account, valueMode]
+  );
+
+  const journalVersion = useJournalVersion();
   React.useEffect(() => {
     setLoading(true);
+    fetchPage(0).then((data) => {
+      if (!data) return;
+      setTransactions(data.transactions ?? []);
+      setTotal(data.total);
+      setLoading(false);
+    });
+  }, [fetchPage, journalVersion]);
 
-    const startDate = formatLocalDate(range?.from);
-    const endDate = formatLocalDate(range?.to);
-    const acct = account || "";
-    const value = valueMode || "";
-    fetch(
-      `http://localhost:8080/api/transactions/?startDate=${startDate}&endDate=${endDate}&valueMode=${value}&account=${acct}`
-    )
-      .then((res) => {
-        if (!res.ok) {
-          return res.text().then((body) => {
-            throw new Error(`(${res.status}) ${res.statusText} : ${body}`);
-          });
-        }
-        return res.json();
-      })
-      .then((data) => {
-        setTransactions(data.transactions);
-        setLoading(false);
-      })
-      .catch((err) => {
-        toast.error(`Error fetching data: ${err.message}`);
-        console.error(err);
-      });
-  }, [range, account, valueMode]);
+  const loadMore = () => {
+    fetchPage(transactions.length).then((data) => {
+      if (!data) return;
+      setTransactions((prev) => [...prev, ...(data.transactions ?? [])]);
+      setTotal(data.total);
+    });
+  };
 
   return (
     <div className="flex flex-col items-center justify-center ">
@@ -113,19 +139,16 @@ export default function TransactionList({
             <div className=" mb-2 hidden lg:block">
               <Separator />
             </div>
-            {transactions.slice(0, visibleCount).map((tx, i) => {
+            {transactions.map((tx, i) => {
               return (
                 <div className="w-full" key={i}>
                   <TransactionItem transaction={tx} />
                 </div>
               );
             })}
-            {visibleCount < transactions.length && (
+            {transactions.length < total && (
               <div className="w-full flex justify-center">
-                <Button
-                  variant="outline"
-                  onClick={() => setVisibleCount(visibleCount + 15)}
-                >
+                <Button variant="outline" onClick={loadMore}>
                   Load more
                 </Button>
               </div>
@@ -200,7 +223,15 @@ function TransactionItem({ transaction }: { transaction: Transaction }) {
               <span className="inline-flex ml-1">
                 <Tooltip>
                   <TooltipTrigger asChild>
-                    <PaperclipIcon className="size-3" />
+                    <a
+                      href={`http://localhost:8080/api/docs/?path=${encodeURIComponent(
+                        transaction.doc.path
+                      )}`}
+                      target="_blank"
+                      rel="noopener noreferrer"
+                    >
+                      <PaperclipIcon className="size-3" />
+                    </a>
                   </TooltipTrigger>
                   <TooltipContent>
                     <p>{transaction.doc.path}</p>
@@ -33,7 +33,16 @@ export type Config = {
     DisplayName: string;
     Account: string;
   }[];
+  StarredComparison: "day" | "week" | "month" | "year" | "lastyear";
   ShowGetStarted: boolean;
+  Backend: "hledger" | "native";
+  Templates: {
+    Name: string;
+    Date: string;
+    Note: string;
+    Comment: string;
+    Postings: { Account: string; Amount: string; Comment: string }[];
+  }[];
 };
 
 // --- Contexts ---
@@ -41,14 +50,17 @@ const ConfigContext = createContext<Config | null>(null);
 const ConfigActionsContext = createContext<{
   updateConfig: (cfg: Config) => Promise<void>;
 } | null>(null);
+// bumped every time the server reports a journal change
+const JournalVersionContext = createContext(0);
 
 // --- Provider ---
 export const ConfigProvider = ({ children }: { children: ReactNode }) => {
   const [config, setConfig] = useState<Config | null>(null);
   const [loading, setLoading] = useState(true);
   const [status, setStatus] = useState("Loading...");
+  const [journalVersion, setJournalVersion] = useState(0);
 
-  useEffect(() => {
+  function fetchConfig() {
     fetch("http://localhost:8080/api/getConfig/")
       .then((res) => res.json())
       .then((data) => {
@@ -59,6 +71,22 @@ export const ConfigProvider = ({ children }: { children: ReactNode }) => {
         console.error("Error fetching config:", err);
         setStatus(`Error fetching config.\n ${err}`);
       });
+  }
+
+  useEffect(() => {
+    fetchConfig();
+  }, []);
+
+  // refetch when journals or the config file change on disk
+  useEffect(() => {
+    const events = new EventSource("http://localhost:8080/api/events/");
+    events.addEventListener("journal", () => {
+      setJournalVersion((v) => v + 1);
+    });
+    events.addEventListener("config", () => {
+      fetchConfig();
+    });
+    return () => events.close();
   }, []);
 
   async function updateConfig(cfg: Config) {
@@ -101,7 +129,9 @@ export const ConfigProvider = ({ children }: { children: ReactNode }) => {
   return (
     <ConfigContext.Provider value={config}>
       <ConfigActionsContext.Provider value={{ updateConfig }}>
-        {children}
+        <JournalVersionContext.Provider value={journalVersion}>
+          {children}
+        </JournalVersionContext.Provider>
       </ConfigActionsContext.Provider>
     </ConfigContext.Provider>
   );
@@ -110,6 +140,10 @@ export const ConfigProvider = ({ children }: { children: ReactNode }) => {
 // --- Hooks ---
 export const useConfig = () => useContext(ConfigContext);
 
+// Changes whenever a journal file changes, add it to the dependencies of
+// effects that fetch report data
+export const useJournalVersion = () => useContext(JournalVersionContext);
+
 // New hook for updating config
 export const useConfigActions = () => {
   const ctx = useContext(ConfigActionsContext);
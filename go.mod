@@ -2,11 +2,15 @@ module github.com/azbashar/teka
 
 go 1.25.0
 
-require github.com/spf13/cobra v1.10.0
+require (
+	github.com/spf13/cobra v1.10.0
+	golang.org/x/sys v0.47.0
+	golang.org/x/term v0.45.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
 	github.com/spf13/pflag v1.0.8 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
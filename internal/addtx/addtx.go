@@ -0,0 +1,204 @@
+// Package addtx is what teka add and the web app share to add a
+// transaction: amounts in the journal's styles, auto-balance, currency
+// conversion with FX gain, and the write checked with hledger. The web
+// app's edits go through the same check.
+package addtx
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/decimal"
+	"github.com/azbashar/teka/internal/entry"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/writelog"
+)
+
+// Context is what adding a transaction needs besides the entry itself.
+type Context struct {
+	// File is the journal the entry is appended to.
+	File string
+	// MainFile is the journal foreign balances are valued from.
+	MainFile string
+	// Journal is the main journal read with the native parser, for
+	// commodity styles and decimal marks. It may be nil.
+	Journal *journal.Journal
+	Runner  hledger.Runner
+}
+
+// ValidationError is a failed hledger check, with what hledger printed.
+type ValidationError struct {
+	Output string
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Output != "" {
+		return e.Output
+	}
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Formatter formats entries in the commodity styles of the main journal.
+func (c *Context) Formatter() entry.Formatter {
+	return entry.Formatter{AmountColumn: config.Cfg.AmountColumn, Journal: c.Journal}
+}
+
+// Commit appends content to File and checks the journal with hledger.
+// When the check fails the entry is taken out again and the error is a
+// *ValidationError. A write that could not be logged is kept and
+// reported with journalfile.ErrNotLogged.
+func (c *Context) Commit(ctx context.Context, content string) (writelog.Entry, error) {
+	written, err := journalfile.Append(c.File, content)
+	if err != nil && !errors.Is(err, journalfile.ErrNotLogged) {
+		return written, err
+	}
+	if checkErr := c.Check(ctx); checkErr != nil {
+		if removeErr := journalfile.Remove(written); removeErr != nil {
+			return written, errors.Join(checkErr, removeErr)
+		}
+		return written, checkErr
+	}
+	return written, err
+}
+
+// Rewrite puts content in place of an entry found with
+// journalfile.Locate and checks the journal with hledger. When the check
+// fails the entry's bytes are put back and the error is a
+// *ValidationError. It returns the entry of the new bytes, a rewrite the
+// write log could not follow is kept and reported with
+// journalfile.ErrNotLogged.
+func (c *Context) Rewrite(ctx context.Context, e writelog.Entry, content string) (writelog.Entry, error) {
+	original, err := journalfile.Content(e)
+	if err != nil {
+		return e, err
+	}
+	written, err := journalfile.Rewrite(e, content)
+	if err != nil && !errors.Is(err, journalfile.ErrNotLogged) {
+		return e, err
+	}
+	if checkErr := c.Check(ctx); checkErr != nil {
+		if _, restoreErr := journalfile.Rewrite(written, original); restoreErr != nil && !errors.Is(restoreErr, journalfile.ErrNotLogged) {
+			return written, errors.Join(checkErr, restoreErr)
+		}
+		return e, checkErr
+	}
+	return written, err
+}
+
+// Check runs hledger check on File. A failed check is a *ValidationError.
+func (c *Context) Check(ctx context.Context) error {
+	stdout, stderr, err := c.Runner.Run(ctx, []string{"check", "-f", c.File})
+	if err != nil {
+		output := strings.TrimSpace(string(stdout) + "\n" + string(stderr))
+		return &ValidationError{Output: output, Err: err}
+	}
+	return nil
+}
+
+// ParseAmount reads an amount as typed, with the decimal marks declared in
+// the journal.
+func (c *Context) ParseAmount(s string) (journal.Amount, error) {
+	return c.Journal.ParseAmount(s)
+}
+
+// Precision is the number of decimals commodity is shown with in the
+// journal, or fallback for a commodity the journal doesn't use.
+func (c *Context) Precision(commodity string, fallback int) int {
+	if c.Journal != nil {
+		if style, ok := c.Journal.Styles[commodity]; ok {
+			return style.Precision
+		}
+	}
+	return fallback
+}
+
+// FormatAmount writes a computed amount in the journal's style for its
+// commodity. Digits beyond the commodity's precision are kept, so round
+// divisions with Precision first.
+func (c *Context) FormatAmount(q decimal.Decimal, commodity string) string {
+	style := journal.Style{Side: 'R', Spaced: true}
+	if c.Journal != nil {
+		if s, ok := c.Journal.Styles[commodity]; ok {
+			style = s
+		}
+	}
+	style.Precision = max(style.Precision, q.Places())
+	return journal.Amount{Quantity: q, Commodity: commodity}.Format(style)
+}
+
+// BalanceAmounts returns the amounts a posting to account needs to
+// balance the transaction, one per commodity left over, like hledger
+// infers a missing amount. Amounts with a cost count in the cost's
+// commodity. [Balanced virtual] postings balance among themselves.
+func (c *Context) BalanceAmounts(tx *entry.Transaction, account string) ([]string, error) {
+	kind := PostingType(account)
+	if kind == journal.VirtualPosting {
+		return nil, errors.New("(virtual) postings don't need balancing")
+	}
+
+	var sum journal.MixedAmount
+	places := map[string]int{}
+	for _, l := range tx.Lines {
+		if l.Type != entry.LinePosting || PostingType(l.Account) != kind {
+			continue
+		}
+		text, _, _ := strings.Cut(l.Amount, ";")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, errors.New("can not balance if postings are missing amount")
+		}
+		a, _, err := c.Journal.ParsePostingAmount(text)
+		if err != nil {
+			return nil, errors.New("invalid amount " + text + ": " + err.Error())
+		}
+		if a == nil {
+			return nil, errors.New("can not balance if postings are missing amount")
+		}
+		sum = sum.Add(a.AtCost())
+		// keep as many decimals as were typed, not what multiplying
+		// by a cost adds
+		typed := *a
+		if a.Cost != nil {
+			typed = a.Cost.Amount
+		}
+		places[typed.Commodity] = max(places[typed.Commodity], typed.Quantity.Places())
+	}
+
+	var amounts []string
+	for _, a := range sum {
+		q := a.Quantity.Neg().Normalize()
+		if q.Round(c.Precision(a.Commodity, q.Places())).IsZero() {
+			continue
+		}
+		if q.Places() < places[a.Commodity] {
+			q = q.WithPlaces(places[a.Commodity])
+		}
+		amounts = append(amounts, c.FormatAmount(q, a.Commodity))
+	}
+	if len(amounts) == 0 {
+		return nil, errors.New("transaction is already balanced")
+	}
+	return amounts, nil
+}
+
+// PostingType tells (virtual) and [balanced virtual] accounts from real
+// ones as they are typed.
+func PostingType(account string) journal.PostingType {
+	account = strings.TrimSpace(strings.TrimLeft(account, "*! "))
+	switch {
+	case strings.HasPrefix(account, "(") && strings.HasSuffix(account, ")"):
+		return journal.VirtualPosting
+	case strings.HasPrefix(account, "[") && strings.HasSuffix(account, "]"):
+		return journal.BalancedVirtualPosting
+	}
+	return journal.RegularPosting
+}
@@ -0,0 +1,134 @@
+package addtx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/decimal"
+	"github.com/azbashar/teka/internal/entry"
+	"github.com/azbashar/teka/internal/hledger"
+)
+
+// Conversion is a currency conversion between a foreign currency account
+// and a local one, as typed: the foreign account is the one marked with $
+// at the account prompt.
+type Conversion struct {
+	ForeignAccount string
+	ForeignAmount  string
+	LocalAccount   string
+	LocalAmount    string
+}
+
+// Convert creates the postings of a currency conversion. Buying foreign
+// currency records its cost. Selling it values the amount sold at the
+// weighted average cost of the foreign balance and books the difference
+// to the FX gain or loss account.
+func (c *Context) Convert(ctx context.Context, conv Conversion) ([]entry.Line, error) {
+	foreign, err := c.ParseAmount(conv.ForeignAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %s: %w", conv.ForeignAmount, err)
+	}
+	if conv.LocalAccount == "" {
+		return nil, errors.New("local account must be specified when converting currencies")
+	}
+	local, err := c.ParseAmount(conv.LocalAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %s: %w", conv.LocalAmount, err)
+	}
+	localCurrency := local.Commodity
+	posting := func(account, amount string) entry.Line {
+		return entry.Line{Type: entry.LinePosting, Account: account, Amount: amount}
+	}
+
+	// Local to foreign conversion
+	if foreign.Quantity.Sign() >= 0 {
+		return []entry.Line{
+			posting(conv.ForeignAccount, conv.ForeignAmount+" @@ "+c.FormatAmount(local.Quantity.Neg(), localCurrency)),
+			posting(conv.LocalAccount, conv.LocalAmount),
+			posting(config.Cfg.Accounts.ConversionAccount, c.FormatAmount(foreign.Quantity.Neg(), foreign.Commodity)),
+			posting(config.Cfg.Accounts.ConversionAccount, c.FormatAmount(local.Quantity.Neg(), localCurrency)),
+		}, nil
+	}
+
+	// Foreign to local conversion
+	totalForeignBalance, totalForeignValue, err := c.foreignBalance(ctx, conv.ForeignAccount, foreign.Commodity)
+	if err != nil {
+		return nil, err
+	}
+
+	var convertedForeignValue decimal.Decimal
+	places := c.Precision(localCurrency, local.Quantity.Places())
+	// convert full balance without rounding error
+	if foreign.Quantity.Neg().Cmp(totalForeignBalance) == 0 {
+		convertedForeignValue = totalForeignValue.Round(places)
+	} else { // partial amount conversion at the weighted average cost
+		convertedForeignValue, err = foreign.Quantity.Neg().Mul(totalForeignValue).Div(totalForeignBalance, places)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gainLoss := local.Quantity.Sub(convertedForeignValue)
+	gainLossAcc := config.Cfg.Accounts.FXLossAccount
+	if gainLoss.Sign() >= 0 {
+		gainLossAcc = config.Cfg.Accounts.FXGainAccount
+	}
+
+	return []entry.Line{
+		posting(conv.ForeignAccount, conv.ForeignAmount+" @@ "+c.FormatAmount(convertedForeignValue, localCurrency)),
+		posting(conv.LocalAccount, conv.LocalAmount),
+		posting(gainLossAcc, c.FormatAmount(gainLoss.Neg(), localCurrency)),
+		posting(config.Cfg.Accounts.ConversionAccount, c.FormatAmount(convertedForeignValue.Neg(), localCurrency)),
+		posting(config.Cfg.Accounts.ConversionAccount, c.FormatAmount(foreign.Quantity.Neg(), foreign.Commodity)),
+	}, nil
+}
+
+// foreignBalance returns the balance of account in currency, and what it
+// cost in the base currency.
+func (c *Context) foreignBalance(ctx context.Context, account, currency string) (decimal.Decimal, decimal.Decimal, error) {
+	var balance, value decimal.Decimal
+
+	// get balance in foreign currency
+	// hledger bal account --file file
+	balOut, _, err := c.Runner.Run(ctx, []string{"bal", account, "-f", c.File, "--no-total", "-O", "json"})
+	if err != nil {
+		return balance, value, err
+	}
+	balReport, err := hledger.DecodeBalanceReport(balOut)
+	if err != nil {
+		return balance, value, err
+	}
+	balance = sumCommodity(balReport, currency)
+	if balance.IsZero() {
+		return balance, value, fmt.Errorf("%s has no balance in %s, can not calculate gain", account, currency)
+	}
+
+	// get value of foreign balance in local currency
+	// hledger bal account --file file --value=then --cost
+	valOut, _, err := c.Runner.Run(ctx, []string{"bal", account, "-f", c.MainFile, "--no-total", "-O", "json", "--value=then," + config.Cfg.BaseCurrency, "--cost"})
+	if err != nil {
+		return balance, value, err
+	}
+	valReport, err := hledger.DecodeBalanceReport(valOut)
+	if err != nil {
+		return balance, value, err
+	}
+	value = sumCommodity(valReport, config.Cfg.BaseCurrency)
+
+	return balance, value, nil
+}
+
+// sumCommodity adds up one commodity over the rows of a balance report.
+func sumCommodity(report *hledger.BalanceReport, commodity string) decimal.Decimal {
+	var sum decimal.Decimal
+	for _, row := range report.Rows {
+		for _, a := range row.Amount {
+			if a.Commodity == commodity {
+				sum = sum.Add(a.Quantity.Decimal())
+			}
+		}
+	}
+	return sum
+}
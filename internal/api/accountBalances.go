@@ -2,17 +2,39 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"os/exec"
+	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/azbashar/teka/internal/config"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
 )
 
+// comparisonStart returns the day whose start the balance of date is
+// compared with. Balances are taken at the end of a day, so "day" compares
+// with the end of the previous day, "month" with the end of the previous
+// month and "lastyear" with the same day one year earlier.
+func comparisonStart(date time.Time, compare string) (time.Time, bool) {
+	switch compare {
+	case "day":
+		return date, true
+	case "week":
+		// weeks start on Monday, like hledger's
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset), true
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	case "year":
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC), true
+	case "lastyear":
+		return date.AddDate(-1, 0, 1), true
+	}
+	return time.Time{}, false
+}
+
 func accountBalances(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w, r)
 	if r.Method != http.MethodGet {
@@ -30,6 +52,19 @@ func accountBalances(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	compare := r.URL.Query().Get("compare")
+	if compare == "" {
+		compare = config.Cfg.StarredComparison
+	}
+	if compare == "" {
+		compare = "month"
+	}
+	compareStart, ok := comparisonStart(parseDate, compare)
+	if !ok {
+		http.Error(w, "Invalid compare value. Allowed options are day/week/month/year/lastyear.", http.StatusBadRequest)
+		return
+	}
+
 	file, expr, err := fileselector.GetRequiredFiles("", parseDate.Format("2006-01-02"), fileArg)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -37,22 +72,46 @@ func accountBalances(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type AccountBalance struct {
-		Id            string  `json:"id"`
-		DisplayName   string  `json:"displayName"`
-		Balance       string  `json:"balance"`
-		Account       string  `json:"account"`
-		PercentChange float64 `json:"percentChange"`
+		Id            string   `json:"id"`
+		DisplayName   string   `json:"displayName"`
+		Balance       string   `json:"balance"`
+		Balances      []Amount `json:"balances"`
+		Account       string   `json:"account"`
+		Change        []Amount `json:"change"`
+		PercentChange float64  `json:"percentChange"`
+		ComparedTo    string   `json:"comparedTo"`
 	}
 
-	// Collect all account names
+	// Match each starred account and its subaccounts, but not accounts
+	// that merely start with the same text
 	var accountArgs []string
 	for _, sa := range config.Cfg.StarredAccounts {
-		accountArgs = append(accountArgs, sa.Account)
+		accountArgs = append(accountArgs, "acct:^"+regexp.QuoteMeta(sa.Account)+"(:|$)")
 	}
 
-	// Helper to run hledger and get balances map
-	runHledger := func(endDate string) (map[string]string, error) {
-		cmdArgs := []string{"bal", "--no-total", "--end", endDate}
+	var starred []string
+	for _, sa := range config.Cfg.StarredAccounts {
+		starred = append(starred, sa.Account)
+	}
+	var nativeJournal *journal.Journal
+	var nativeFilter journal.Filter
+	if config.UseNativeBackend() {
+		nativeJournal, nativeFilter, err = readJournal(file, expr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Helper to run hledger and get the balance report. --end is
+	// exclusive, tree mode gives parents their subaccounts' balances.
+	balancesBefore := func(end time.Time) (*hledger.BalanceReport, error) {
+		if nativeJournal != nil {
+			f := nativeFilter
+			f.End = end
+			return nativeBalanceReport(nativeJournal, f, starred), nil
+		}
+		cmdArgs := []string{"bal", "--tree", "--no-elide", "--no-total", "-O", "json", "--end", end.Format("2006-01-02")}
 		cmdArgs = append(cmdArgs, accountArgs...)
 		for _, f := range file {
 			cmdArgs = append(cmdArgs, "-f", f)
@@ -62,65 +121,57 @@ func accountBalances(w http.ResponseWriter, r *http.Request) {
 			cmdArgs = append(cmdArgs, expr)
 		}
 
-		cmd := exec.Command("hledger", cmdArgs...)
-		output, err := cmd.CombinedOutput()
+		output, err := runHledger(r, cmdArgs)
 		if err != nil {
-			fmt.Println(string(output))
-			return nil, fmt.Errorf("hledger error: %w", err)
+			return nil, err
 		}
-
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		result := make(map[string]string)
-		for _, line := range lines {
-			for _, acc := range accountArgs {
-				if strings.Contains(line, acc) {
-					fields := strings.Fields(line)
-					if len(fields) >= 2 {
-						result[acc] = fields[0] + " " + fields[1]
-					}
-				}
-			}
-		}
-		return result, nil
+		return hledger.DecodeBalanceReport(output)
 	}
 
-	// Current month balances
-	currentBalances, err := runHledger(date)
+	// Balances at the end of the selected day
+	currentBalances, err := balancesBefore(parseDate.AddDate(0, 0, 1))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), hledgerStatus(err))
 		return
 	}
 
-	// Previous month balances
-	lastMonth := parseDate.AddDate(0, -1, 0).Format("2006-01-02")
-	previousBalances, err := runHledger(lastMonth)
+	// Balances at the end of the comparison window
+	previousBalances, err := balancesBefore(compareStart)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), hledgerStatus(err))
 		return
 	}
 
 	// Build response
 	var balances []AccountBalance
 	for id, sa := range config.Cfg.StarredAccounts {
-		cur := currentBalances[sa.Account]
-		if cur == "" {
-			cur = "0"
-		}
-		prev := previousBalances[sa.Account]
-		if prev == "" {
-			prev = "0"
-		}
+		cur, _ := currentBalances.Row(sa.Account)
+		prev, _ := previousBalances.Row(sa.Account)
 
-		// Parse numbers (assuming amount currency format like "123.45 USD")
-		curFields := strings.Fields(cur)
-		prevFields := strings.Fields(prev)
+		curAmounts := toAmounts(cur.Amount)
+		prevAmounts := toAmounts(prev.Amount)
+
+		// change per commodity: current minus previous
+		change := addAmounts([]Amount{}, curAmounts)
+		for _, p := range prevAmounts {
+			change = addAmounts(change, []Amount{{Amount: -p.Amount, Currency: p.Currency}})
+		}
 
+		// percent change of the main commodity, the base currency if held
 		var curVal, prevVal float64
-		if len(curFields) > 0 {
-			curVal, _ = strconv.ParseFloat(curFields[0], 64)
+		mainCurrency := config.Cfg.BaseCurrency
+		if len(curAmounts) > 0 && !hasCurrency(curAmounts, mainCurrency) {
+			mainCurrency = curAmounts[0].Currency
 		}
-		if len(prevFields) > 0 {
-			prevVal, _ = strconv.ParseFloat(prevFields[0], 64)
+		for _, a := range curAmounts {
+			if a.Currency == mainCurrency {
+				curVal += a.Amount
+			}
+		}
+		for _, a := range prevAmounts {
+			if a.Currency == mainCurrency {
+				prevVal += a.Amount
+			}
 		}
 
 		var pct float64
@@ -133,9 +184,12 @@ func accountBalances(w http.ResponseWriter, r *http.Request) {
 		balances = append(balances, AccountBalance{
 			Id:            strconv.Itoa(id),
 			DisplayName:   sa.DisplayName,
-			Balance:       cur,
+			Balance:       cur.Amount.String(),
+			Balances:      curAmounts,
 			Account:       sa.Account,
+			Change:        change,
 			PercentChange: pct,
+			ComparedTo:    compareStart.AddDate(0, 0, -1).Format("2006-01-02"),
 		})
 	}
 
@@ -148,3 +202,12 @@ func accountBalances(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonResponse)
 }
+
+func hasCurrency(amounts []Amount, currency string) bool {
+	for _, a := range amounts {
+		if a.Currency == currency {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azbashar/teka/internal/addtx"
+	"github.com/azbashar/teka/internal/entry"
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/journal"
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/writelog"
+)
+
+// apiTag is a tag as the API returns and accepts them.
+type apiTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// newTransaction is the body of POST /api/transactions. A posting whose
+// account starts with $ is a foreign currency account, converted to the
+// local account and amount of the posting after it, like at the teka add
+// prompts. An amount of "." balances the transaction.
+type newTransaction struct {
+	Date        string   `json:"date"` // YYYY-MM-DD[=YYYY-MM-DD], default today
+	Status      string   `json:"status"`
+	Code        string   `json:"code"`
+	Payee       string   `json:"payee"`
+	Description string   `json:"description"`
+	Comment     string   `json:"comment"`
+	Tags        []apiTag `json:"tags"`
+	Postings    []struct {
+		Account string   `json:"account"`
+		Amount  string   `json:"amount"`
+		Comment string   `json:"comment"`
+		Status  string   `json:"status"`
+		Tags    []apiTag `json:"tags"`
+	} `json:"postings"`
+}
+
+// validationError is the response when hledger check rejects the entry.
+type validationError struct {
+	Error  string `json:"error"`
+	Output string `json:"output"`
+}
+
+// transactions lists transactions on GET and adds one on POST. PUT and
+// DELETE on /api/transactions/{id} change the transaction with that
+// source ID.
+func transactions(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/transactions/")
+	switch {
+	case r.Method == http.MethodOptions:
+		enableCORS(w, r)
+	case id != "" && r.Method == http.MethodPut:
+		editTransaction(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		deleteTransaction(w, r, id)
+	case id != "":
+		enableCORS(w, r)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodPost:
+		addTransaction(w, r)
+	default:
+		getTransactions(w, r)
+	}
+}
+
+// addTransaction writes a transaction to the file fileselector picks for
+// its date, formatted like teka add does, and checks the journal with
+// hledger. An entry that fails the check is taken out again.
+func addTransaction(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(w, r) || !jsonBody(w, r) {
+		return
+	}
+
+	var in newTransaction
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := entryDate(in.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := fileselector.GetCurrentFile(date[:10], fileArg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	add, err := txContext(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the write and its check finish even if the client goes away
+	ctx := context.WithoutCancel(r.Context())
+	tx, err := buildTransaction(ctx, add, date, in)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	content := "\n" + add.Formatter().Format(tx)
+	written, err := add.Commit(ctx, content)
+	if !writeError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		File   string `json:"file"`
+		Offset int64  `json:"offset"`
+		Hash   string `json:"hash"`
+		Entry  string `json:"entry"`
+	}{written.File, written.Offset, written.Hash, strings.TrimPrefix(content, "\n")})
+}
+
+// entryDate checks a YYYY-MM-DD date with an optional =YYYY-MM-DD
+// secondary date. An empty date is today.
+func entryDate(date string) (string, error) {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return time.Now().Format("2006-01-02"), nil
+	}
+	for _, part := range strings.Split(date, "=") {
+		if _, err := time.Parse("2006-01-02", part); err != nil {
+			return "", fmt.Errorf("invalid date %q, use YYYY-MM-DD", date)
+		}
+	}
+	return date, nil
+}
+
+func buildTransaction(ctx context.Context, add *addtx.Context, date string, in newTransaction) (entry.Transaction, error) {
+	status, err := entry.ParseStatus(in.Status)
+	if err != nil {
+		return entry.Transaction{}, err
+	}
+	note := strings.TrimSpace(in.Description)
+	if in.Comment != "" {
+		note += " ; " + in.Comment
+	}
+	tx := entry.Transaction{Lines: []entry.Line{{
+		Type:   entry.LineTransaction,
+		Date:   date,
+		Status: status,
+		Code:   in.Code,
+		Payee:  strings.TrimSpace(in.Payee),
+		Note:   note,
+		Tags:   entryTags(in.Tags),
+	}}}
+
+	if len(in.Postings) == 0 {
+		return tx, errors.New("transaction has no postings")
+	}
+	for i := 0; i < len(in.Postings); i++ {
+		p := in.Postings[i]
+		account := strings.TrimSpace(p.Account)
+		if account == "" {
+			return tx, errors.New("posting without an account")
+		}
+
+		// Currency conversion with the next posting
+		if foreign, ok := strings.CutPrefix(account, "$"); ok {
+			if i+1 == len(in.Postings) {
+				return tx, errors.New("a currency conversion needs a local posting after the foreign one")
+			}
+			local := in.Postings[i+1]
+			lines, err := add.Convert(ctx, addtx.Conversion{
+				ForeignAccount: foreign,
+				ForeignAmount:  p.Amount,
+				LocalAccount:   strings.TrimSpace(local.Account),
+				LocalAmount:    local.Amount,
+			})
+			if err != nil {
+				return tx, err
+			}
+			tx.Lines = append(tx.Lines, lines...)
+			i++
+			continue
+		}
+
+		status, err := entry.ParseStatus(p.Status)
+		if err != nil {
+			return tx, err
+		}
+		amounts := []string{strings.TrimSpace(p.Amount)}
+		// Auto balance
+		if amounts[0] == "." {
+			if amounts, err = add.BalanceAmounts(&tx, account); err != nil {
+				return tx, err
+			}
+		}
+		for j, amount := range amounts {
+			line := entry.Line{Type: entry.LinePosting, Status: status, Account: account, Amount: amount}
+			// the comment and tags go with the first amount
+			if j == 0 {
+				if p.Comment != "" {
+					line.Amount += " ; " + p.Comment
+				}
+				line.Tags = entryTags(p.Tags)
+			}
+			tx.Lines = append(tx.Lines, line)
+		}
+	}
+	return tx, nil
+}
+
+func entryTags(tags []apiTag) []entry.Tag {
+	var out []entry.Tag
+	for _, t := range tags {
+		out = append(out, entry.Tag{Name: t.Key, Value: t.Value})
+	}
+	return out
+}
+
+// txContext is the addtx context for writing a transaction to file. Like
+// teka add, a journal the native parser can't read just leaves amounts as
+// they were sent.
+func txContext(file string) (*addtx.Context, error) {
+	mainFile, err := fileselector.GetMainFile(fileArg, mainFileArg)
+	if err != nil {
+		return nil, err
+	}
+	// a write changes the journal, so its check must not come from the cache
+	tc := &addtx.Context{File: file, MainFile: mainFile, Runner: execRunner}
+	if j, err := journal.Parse(mainFile); err == nil {
+		tc.Journal = j
+	}
+	return tc, nil
+}
+
+// writeError answers for an error from addtx and reports whether the
+// write went through.
+func writeError(w http.ResponseWriter, err error) bool {
+	var invalid *addtx.ValidationError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(validationError{Error: "hledger check failed, the journal was left as it was", Output: invalid.Output})
+		return false
+	case errors.Is(err, writelog.ErrChanged):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return false
+	case errors.Is(err, journalfile.ErrNotLogged):
+		fmt.Println(err)
+		return true
+	}
+	fmt.Println("Error writing transaction:", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	return false
+}
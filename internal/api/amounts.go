@@ -0,0 +1,56 @@
+package api
+
+import "github.com/azbashar/teka/internal/hledger"
+
+// Amount is one commodity of an amount in API responses.
+type Amount struct {
+	Amount   float64     `json:"amount"`
+	Currency string      `json:"currency"`
+	Cost     *AmountCost `json:"cost,omitempty"`
+}
+
+// AmountCost is the @ or @@ cost of an Amount. Total is true for @@.
+type AmountCost struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Total    bool    `json:"total"`
+}
+
+// toAmounts converts every commodity of a hledger amount.
+func toAmounts(m hledger.MixedAmount) []Amount {
+	amounts := []Amount{}
+	for _, a := range m {
+		amt := Amount{
+			Amount:   a.Quantity.FloatingPoint,
+			Currency: a.Commodity,
+		}
+		if a.Cost != nil {
+			amt.Cost = &AmountCost{
+				Amount:   a.Cost.Amount.Quantity.FloatingPoint,
+				Currency: a.Cost.Amount.Commodity,
+				Total:    a.Cost.IsTotal(),
+			}
+		}
+		amounts = append(amounts, amt)
+	}
+	return amounts
+}
+
+// addAmounts adds b to a commodity by commodity, keeping the order in
+// which commodities first appear. Costs are dropped.
+func addAmounts(a, b []Amount) []Amount {
+	for _, amt := range b {
+		found := false
+		for i := range a {
+			if a[i].Currency == amt.Currency {
+				a[i].Amount += amt.Amount
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, Amount{Amount: amt.Amount, Currency: amt.Currency})
+		}
+	}
+	return a
+}
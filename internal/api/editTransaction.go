@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journalfile"
+	"github.com/azbashar/teka/internal/writelog"
+)
+
+// source is where a transaction was read from: lines Line to EndLine of
+// File, and the hash of those bytes. PUT and DELETE find the transaction
+// by ID and only change it while its bytes still have the Hash the client
+// sends in If-Match.
+type source struct {
+	ID      string `json:"id"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine"`
+	Hash    string `json:"hash"`
+}
+
+func newSource(e writelog.Entry, line, endLine int) *source {
+	id := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d:%s", line, endLine, e.File))
+	return &source{ID: id, File: e.File, Line: line, EndLine: endLine, Hash: e.Hash}
+}
+
+// sources finds the bytes of transactions from their hledger source
+// positions, reading each file once.
+type sources map[string]*journalfile.Lines
+
+func (s sources) of(tx hledger.Transaction) *source {
+	// the end position is the line after the entry
+	if len(tx.SourcePos) != 2 || tx.SourcePos[0].File != tx.SourcePos[1].File {
+		return nil
+	}
+	file, line, endLine := tx.SourcePos[0].File, tx.SourcePos[0].Line, tx.SourcePos[1].Line-1
+	lines, ok := s[file]
+	if !ok {
+		lines, _ = journalfile.ReadLines(file)
+		s[file] = lines
+	}
+	if lines == nil {
+		return nil
+	}
+	e, err := lines.Entry(line, endLine)
+	if err != nil {
+		return nil
+	}
+	return newSource(e, line, endLine)
+}
+
+// errNoTransaction is returned for an ID that doesn't point into one of
+// the journals.
+var errNoTransaction = errors.New("no such transaction")
+
+// locate finds the transaction an ID points to. Only journals teka reads
+// from can be changed.
+func locate(id string) (writelog.Entry, int, int, error) {
+	var none writelog.Entry
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return none, 0, 0, errNoTransaction
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return none, 0, 0, errNoTransaction
+	}
+	line, err1 := strconv.Atoi(parts[0])
+	endLine, err2 := strconv.Atoi(parts[1])
+	file := filepath.Clean(parts[2])
+	if err1 != nil || err2 != nil || !filepath.IsAbs(file) {
+		return none, 0, 0, errNoTransaction
+	}
+	if !slices.Contains(journalFiles(), file) {
+		return none, 0, 0, errNoTransaction
+	}
+	e, err := journalfile.Locate(file, line, endLine)
+	if err != nil {
+		return none, 0, 0, errNoTransaction
+	}
+	return e, line, endLine, nil
+}
+
+// journalFiles are the absolute paths of the journals and the files they
+// include.
+func journalFiles() []string {
+	var files []string
+	for _, f := range fileselector.WithIncludes(fileselector.GetJournalRoots(fileArg, mainFileArg)) {
+		if abs, err := filepath.Abs(f); err == nil {
+			files = append(files, abs)
+		}
+	}
+	return files
+}
+
+// editTransaction replaces a transaction with the one in the body, given
+// like to POST, in the same file. The journal is checked with hledger and
+// the transaction is put back when the check fails.
+func editTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	if !sameOrigin(w, r) || !jsonBody(w, r) {
+		return
+	}
+
+	e, line, _, ok := lockedTransaction(w, r, id)
+	if !ok {
+		return
+	}
+	var in newTransaction
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := entryDate(in.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tc, err := txContext(e.File)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	tx, err := buildTransaction(ctx, tc, date, in)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content := tc.Formatter().Format(tx)
+	written, err := tc.Rewrite(ctx, e, content)
+	if !writeError(w, err) {
+		return
+	}
+
+	endLine := line + strings.Count(content, "\n") - 1
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Source *source `json:"source"`
+		Entry  string  `json:"entry"`
+	}{newSource(written, line, endLine), content})
+}
+
+// deleteTransaction takes a transaction out of its file, with the blank
+// line after it. The journal is checked with hledger and the transaction
+// is put back when the check fails.
+func deleteTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	if !sameOrigin(w, r) {
+		return
+	}
+
+	e, line, endLine, ok := lockedTransaction(w, r, id)
+	if !ok {
+		return
+	}
+	// don't leave two blank lines where the transaction was
+	if gap, err := journalfile.Locate(e.File, line, endLine+1); err == nil {
+		text, err := journalfile.Content(gap)
+		if err == nil && strings.TrimSpace(text[e.Length:]) == "" && writelog.Hash([]byte(text[:e.Length])) == e.Hash {
+			e = gap
+		}
+	}
+	tc, err := txContext(e.File)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tc.Rewrite(context.WithoutCancel(r.Context()), e, "")
+	if !writeError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lockedTransaction finds the transaction for PUT and DELETE, and checks
+// it is still the one the client saw: If-Match must carry the hash it was
+// listed with.
+func lockedTransaction(w http.ResponseWriter, r *http.Request, id string) (writelog.Entry, int, int, bool) {
+	hash := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if hash == "" {
+		http.Error(w, "If-Match with the transaction's source hash is required", http.StatusPreconditionRequired)
+		return writelog.Entry{}, 0, 0, false
+	}
+	e, line, endLine, err := locate(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return e, 0, 0, false
+	}
+	if e.Hash != hash {
+		http.Error(w, writelog.ErrChanged.Error(), http.StatusPreconditionFailed)
+		return e, 0, 0, false
+	}
+	return e, line, endLine, true
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+)
+
+// accountNode is an account of the tree /api/accounts returns. Dates,
+// posting counts and balances include the subaccounts.
+type accountNode struct {
+	Name      string         `json:"name"`
+	ShortName string         `json:"shortName"`
+	Type      string         `json:"type"` // A, L, E, R, X, C, V or ""
+	Declared  *declaration   `json:"declared"`
+	Tags      []apiTag       `json:"tags"`
+	FirstDate string         `json:"firstDate"`
+	LastDate  string         `json:"lastDate"`
+	Postings  int            `json:"postings"`
+	Balance   []Amount       `json:"balance"`
+	Children  []*accountNode `json:"children"`
+}
+
+// declaration is where an account directive is. With the hledger backend
+// both are empty when the native parser can't read the journal.
+type declaration struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// getAccounts returns every account of the journal, declared or used, as
+// a tree. Parents that are only implied by their subaccounts are included.
+func getAccounts(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, expr, err := fileselector.GetRequiredFiles("", "", fileArg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// balances at the end of today
+	end := time.Now().AddDate(0, 0, 1)
+
+	var names, types, declared []string
+	var txs []hledger.Transaction
+	var balances *hledger.BalanceReport
+	var warning string
+	// where account directives are and their tags are read with the
+	// native parser with either backend, hledger has no JSON for them
+	j, f, nativeErr := readJournal(files, expr)
+	if config.UseNativeBackend() {
+		if nativeErr != nil {
+			http.Error(w, nativeErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		names = j.AccountNames()
+		for _, name := range names {
+			types = append(types, j.AccountType(name))
+		}
+		for _, tx := range j.Select(f) {
+			txs = append(txs, toHledgerTransaction(tx))
+		}
+		f.End = end
+		balances = nativeBalanceReport(j, f, withParents(names))
+	} else {
+		var fileArgs []string
+		for _, file := range files {
+			fileArgs = append(fileArgs, "-f", file)
+		}
+		query := fileArgs
+		if expr != "" {
+			query = append(query, expr)
+		}
+
+		out, err := runHledger(r, append([]string{"accounts", "--types"}, fileArgs...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		names, types = parseAccountTypes(out)
+
+		out, err = runHledger(r, append([]string{"accounts", "--declared"}, fileArgs...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		declared, _ = parseAccountTypes(out)
+		if nativeErr != nil {
+			fmt.Println("Error reading account directives:", nativeErr)
+			warning = "account directives could not be read: " + nativeErr.Error()
+		}
+
+		out, err = runHledger(r, append([]string{"print", "-O", "json"}, query...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		if txs, err = hledger.DecodeTransactions(out); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		out, err = runHledger(r, append([]string{"bal", "--tree", "--no-elide", "--no-total", "-O", "json", "--end", end.Format("2006-01-02")}, query...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		if balances, err = hledger.DecodeBalanceReport(out); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Build the tree, parents before their subaccounts
+	nodes := map[string]*accountNode{}
+	var roots []*accountNode
+	var node func(name string) *accountNode
+	node = func(name string) *accountNode {
+		if n, ok := nodes[name]; ok {
+			return n
+		}
+		n := &accountNode{Name: name, ShortName: name, Tags: []apiTag{}, Balance: []Amount{}, Children: []*accountNode{}}
+		if parent := parentName(name); parent != "" {
+			node(parent).Children = append(node(parent).Children, n)
+			n.ShortName = name[len(parent)+1:]
+		} else {
+			roots = append(roots, n)
+		}
+		nodes[name] = n
+		return n
+	}
+	for i, name := range names {
+		node(name).Type = types[i]
+	}
+	if nativeErr == nil {
+		for name, n := range nodes {
+			if n.Type == "" {
+				n.Type = j.AccountType(name)
+			}
+		}
+		for _, decl := range j.Accounts {
+			n := node(decl.Name)
+			if n.Declared != nil {
+				continue
+			}
+			n.Declared = &declaration{File: decl.Pos.File, Line: decl.Pos.Line}
+			for _, t := range decl.Tags {
+				n.Tags = append(n.Tags, apiTag{Key: t.Name, Value: t.Value})
+			}
+		}
+	}
+	for _, name := range declared {
+		if n := node(name); n.Declared == nil {
+			n.Declared = &declaration{}
+		}
+	}
+
+	// Postings count for the account and its parents
+	for _, tx := range txs {
+		for _, p := range tx.Postings {
+			date := tx.Date
+			if p.Date != nil {
+				date = *p.Date
+			}
+			for n := node(p.Account); n != nil; n = nodes[parentName(n.Name)] {
+				n.Postings++
+				if n.FirstDate == "" || date < n.FirstDate {
+					n.FirstDate = date
+				}
+				if date > n.LastDate {
+					n.LastDate = date
+				}
+			}
+		}
+	}
+	for name, n := range nodes {
+		if row, ok := balances.Row(name); ok {
+			n.Balance = toAmounts(row.Amount)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Accounts []*accountNode `json:"accounts"`
+		Warning  string         `json:"warning,omitempty"`
+	}{roots, warning})
+}
+
+// parseAccountTypes reads the output of `hledger accounts`: one account
+// per line, followed by "; type: X" with --types.
+func parseAccountTypes(out []byte) ([]string, []string) {
+	var names, types []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name, comment, _ := strings.Cut(line, ";")
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		_, accountType, _ := strings.Cut(comment, "type:")
+		names = append(names, name)
+		types = append(types, strings.TrimSpace(accountType))
+	}
+	return names, types
+}
+
+// withParents returns the accounts and all their parents.
+func withParents(names []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, name := range names {
+		for n := name; n != "" && !seen[n]; n = parentName(n) {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// parentName is the account name without its last segment, "" for a top
+// level account.
+func parentName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
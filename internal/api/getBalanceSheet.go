@@ -4,13 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/azbashar/teka/internal/config"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
 )
 
 func getBalanceSheet(w http.ResponseWriter, r *http.Request) {
@@ -91,11 +91,9 @@ func getBalanceSheet(w http.ResponseWriter, r *http.Request) {
 		cmdArgs = append(cmdArgs, expr)
 	}
 
-	bs, err := exec.Command("hledger", cmdArgs...).CombinedOutput()
+	bs, err := runHledger(r, cmdArgs)
 	if err != nil {
-		fmt.Println(string(bs))
-		fmt.Println("Error running hledger:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), hledgerStatus(err))
 		return
 	}
 	if outputFormat == "html" {
@@ -115,142 +113,13 @@ func getBalanceSheet(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 	} else if outputFormat == "json" {
 		w.Header().Set("Content-Type", "application/json")
-		var bsData map[string]any
-		if err := json.Unmarshal(bs, &bsData); err != nil {
-			http.Error(w, fmt.Sprintf("failed to parse hledger output: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		// build period-based response
-		cbrDates, ok := bsData["cbrDates"].([]any)
-		if !ok {
-			http.Error(w, "invalid cbrDates in hledger output", http.StatusInternalServerError)
-			return
-		}
-
-		cbrSubreports, ok := bsData["cbrSubreports"].([]any)
-		if !ok {
-			http.Error(w, "invalid cbrSubreports in hledger output", http.StatusInternalServerError)
+		report, err := hledger.DecodeCompoundReport(bs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		cbrTotals, ok := bsData["cbrTotals"].(map[string]any)
-		if !ok {
-			http.Error(w, "invalid cbrTotals in hledger output", http.StatusInternalServerError)
-			return
-		}
-		prrAmountsTotals, _ := cbrTotals["prrAmounts"].([]any)
-
-		var periodReports []map[string]any
-
-		// loop over each period index
-		for i, periodRange := range cbrDates {
-			rangeArr, ok := periodRange.([]any)
-			if !ok || len(rangeArr) < 2 {
-				continue
-			}
-			fromDate := ""
-			toDate := ""
-			if f, ok := rangeArr[0].(map[string]any); ok {
-				fromDate, _ = f["contents"].(string)
-			}
-			if t, ok := rangeArr[1].(map[string]any); ok {
-				toDate, _ = t["contents"].(string)
-			}
-
-			var data []map[string]any
-			totalAmount := 0.0
-			totalCurrency := config.Cfg.BaseCurrency
-
-			// walk through subreports -> prRows -> prrAmounts[i]
-			for _, sub := range cbrSubreports {
-				subArr, ok := sub.([]any)
-				if !ok || len(subArr) < 2 {
-					continue
-				}
-				dataMap, ok := subArr[1].(map[string]any)
-				if !ok {
-					continue
-				}
-				prRows, ok := dataMap["prRows"].([]any)
-				if !ok {
-					continue
-				}
-
-				for _, row := range prRows {
-					rowMap, ok := row.(map[string]any)
-					if !ok {
-						continue
-					}
-					accountName, _ := rowMap["prrName"].(string)
-					prrAmounts, ok := rowMap["prrAmounts"].([]any)
-					if !ok || i >= len(prrAmounts) {
-						continue
-					}
-					periodAmounts, ok := prrAmounts[i].([]any)
-					if !ok || len(periodAmounts) == 0 {
-						continue
-					}
-
-					amtData, ok := periodAmounts[0].(map[string]any)
-					if !ok {
-						continue
-					}
-					amount := 0.0
-					currency := config.Cfg.BaseCurrency
-					if aq, ok := amtData["aquantity"].(map[string]any); ok {
-						amount, _ = aq["floatingPoint"].(float64)
-					}
-					if comm, ok := amtData["acommodity"].(string); ok {
-						currency = comm
-					}
-
-					if totalCurrency == config.Cfg.BaseCurrency {
-						totalCurrency = currency
-					}
-					totalAmount += amount
-
-					data = append(data, map[string]any{
-						"account":  accountName,
-						"amount":   amount,
-						"currency": currency,
-					})
-				}
-			}
-
-			// extract period total if available
-			periodTotal := map[string]any{
-				"amount":   totalAmount,
-				"currency": totalCurrency,
-			}
-			if i < len(prrAmountsTotals) {
-				if arr, ok := prrAmountsTotals[i].([]any); ok && len(arr) > 0 {
-					if amtData, ok := arr[0].(map[string]any); ok {
-						if aq, ok := amtData["aquantity"].(map[string]any); ok {
-							if fp, ok := aq["floatingPoint"].(float64); ok {
-								periodTotal["amount"] = fp
-							}
-						}
-						if comm, ok := amtData["acommodity"].(string); ok {
-							periodTotal["currency"] = comm
-						}
-					}
-				}
-			}
-
-			if len(data) > 0 {
-				periodReports = append(periodReports, map[string]any{
-					"dates": map[string]string{
-						"from": fromDate,
-						"to":   toDate,
-					},
-					"total": periodTotal,
-					"data":  data,
-				})
-			}
-		}
-
-		resp := periodReports
+		resp := periodReports(report)
 
 		json.NewEncoder(w).Encode(resp)
 		return
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/azbashar/teka/internal/docs"
+	"github.com/azbashar/teka/internal/fileselector"
+)
+
+// getDocument serves the document a doc: tag points to, given as the path
+// parameter. Only files in the documents directory are served.
+func getDocument(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("path")
+	if name == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	root, err := fileselector.GetLedgerRoot(fileArg, mainFileArg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := docs.Open(root, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			http.Error(w, "Document not found", http.StatusNotFound)
+		case errors.Is(err, docs.ErrOutside):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			// os.Root reports paths escaping it with its own errors
+			fmt.Println("Error opening document:", err)
+			http.Error(w, "Document can not be opened", http.StatusForbidden)
+		}
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	// documents are shown, never run as part of the app
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -2,19 +2,34 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/azbashar/teka/internal/config"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
 )
 
+// NetWorth is one point of the net worth series. Liabilities are positive,
+// the way hledger's balance sheet shows them. Breakdown holds the
+// contribution of each top-level account or commodity to Networth.
 type NetWorth struct {
-	Date     string  `json:"date"`
-	Networth float64 `json:"networth"`
-	Currency string  `json:"currency"`
+	Date        string             `json:"date"`
+	Networth    float64            `json:"networth"`
+	Assets      float64            `json:"assets"`
+	Liabilities float64            `json:"liabilities"`
+	Currency    string             `json:"currency"`
+	Breakdown   map[string]float64 `json:"breakdown,omitempty"`
+}
+
+var netWorthIntervals = map[string]string{
+	"daily":     "--daily",
+	"weekly":    "--weekly",
+	"monthly":   "--monthly",
+	"quarterly": "--quarterly",
+	"yearly":    "--yearly",
 }
 
 func getNetWorth(w http.ResponseWriter, r *http.Request) {
@@ -26,12 +41,27 @@ func getNetWorth(w http.ResponseWriter, r *http.Request) {
 
 	startDate := r.URL.Query().Get("startDate")
 	endDate := r.URL.Query().Get("endDate")
+	interval := r.URL.Query().Get("interval")
+	breakdown := r.URL.Query().Get("breakdown")
+
+	if interval == "" {
+		interval = "daily"
+	}
+	intervalFlag, ok := netWorthIntervals[interval]
+	if !ok {
+		http.Error(w, "Invalid interval. Allowed options are daily/weekly/monthly/quarterly/yearly.", http.StatusBadRequest)
+		return
+	}
+	if breakdown != "" && breakdown != "account" && breakdown != "commodity" {
+		http.Error(w, "Invalid breakdown. Allowed options are account/commodity.", http.StatusBadRequest)
+		return
+	}
 
 	// Prepare hledger command: use balance sheet
 	cmdArgs := []string{
-		"bs",      // balance sheet
-		"-V",      // value in default currency
-		"--daily", // daily snapshot
+		"bs",                                     // balance sheet
+		"--value=end," + config.Cfg.BaseCurrency, // value in base currency
+		intervalFlag,
 		"-O", "json",
 	}
 	if startDate != "" {
@@ -54,119 +84,162 @@ func getNetWorth(w http.ResponseWriter, r *http.Request) {
 		cmdArgs = append(cmdArgs, expr)
 	}
 
-	cmd := exec.Command("hledger", cmdArgs...)
-	output, err := cmd.CombinedOutput()
+	report, err := runCompoundReport(r, cmdArgs)
 	if err != nil {
-		fmt.Println(string(output))
-		http.Error(w, "hledger error: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), hledgerStatus(err))
 		return
 	}
 
-	var bsData map[string]interface{}
-	if err := json.Unmarshal(output, &bsData); err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse hledger output: %v", err), http.StatusInternalServerError)
-		return
+	assets, _ := report.Subreport("Assets")
+	liabilities, _ := report.Subreport("Liabilities")
+
+	var results []NetWorth
+	for i, span := range report.Dates {
+		if span.End == "" {
+			continue
+		}
+
+		assetVal := baseAmount(assets.Report.Totals.Period(i))
+		liabVal := baseAmount(liabilities.Report.Totals.Period(i))
+
+		results = append(results, NetWorth{
+			Date:        span.End,
+			Networth:    assetVal - liabVal,
+			Assets:      assetVal,
+			Liabilities: liabVal,
+			Currency:    config.Cfg.BaseCurrency,
+		})
 	}
 
-	cbrDates, ok := bsData["cbrDates"].([]interface{})
-	if !ok {
-		http.Error(w, "invalid cbrDates in hledger output", http.StatusInternalServerError)
+	switch breakdown {
+	case "account":
+		err = netWorthByAccount(r, cmdArgs, results)
+	case "commodity":
+		err = netWorthByCommodity(r, cmdArgs, results)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), hledgerStatus(err))
 		return
 	}
 
-	cbrSubreports, ok := bsData["cbrSubreports"].([]interface{})
-	if !ok {
-		http.Error(w, "invalid cbrSubreports in hledger output", http.StatusInternalServerError)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// netWorthByAccount splits each point by the accounts one level below the
+// assets and liabilities roots.
+func netWorthByAccount(r *http.Request, cmdArgs []string, results []NetWorth) error {
+	depth := strings.Count(config.Cfg.Accounts.AssetsAccount, ":") + 2
+	args := append([]string{}, cmdArgs...)
+	args = append(args, "--flat", "--depth="+strconv.Itoa(depth))
+
+	report, err := runCompoundReport(r, args)
+	if err != nil {
+		return err
 	}
 
-	// Helper to get totals safely
-	getTotals := func(name string) []map[string]interface{} {
-		for _, sub := range cbrSubreports {
-			subArr, ok := sub.([]interface{})
-			if !ok || len(subArr) < 2 {
-				continue
-			}
-			subName, ok := subArr[0].(string)
-			if !ok || !strings.EqualFold(subName, name) {
-				continue
-			}
-			data, ok := subArr[1].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			prTotals, ok := data["prTotals"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			prrAmounts, ok := prTotals["prrAmounts"].([]interface{})
-			if !ok || len(prrAmounts) == 0 {
-				continue
-			}
-			var result []map[string]interface{}
-			for _, period := range prrAmounts {
-				periodSlice, ok := period.([]interface{})
-				if !ok || len(periodSlice) == 0 {
-					result = append(result, nil)
-					continue
-				}
-				amount, ok := periodSlice[0].(map[string]interface{})
-				if !ok {
-					result = append(result, nil)
-					continue
+	for _, sub := range report.Subreports {
+		sign := 1.0
+		if strings.EqualFold(sub.Name, "Liabilities") {
+			sign = -1
+		} else if !strings.EqualFold(sub.Name, "Assets") {
+			continue
+		}
+		for _, row := range sub.Report.Rows {
+			addBreakdown(results, report.Dates, row.Name, sign, row.Amounts)
+		}
+	}
+	return nil
+}
+
+// netWorthByCommodity splits each point by the commodity that is held,
+// valued in the base currency. Each commodity is valued in its own run,
+// since a valued report no longer tells commodities apart.
+func netWorthByCommodity(r *http.Request, cmdArgs []string, results []NetWorth) error {
+	// the same report without valuation lists the commodities
+	var args []string
+	for _, a := range cmdArgs {
+		if !strings.HasPrefix(a, "--value=") {
+			args = append(args, a)
+		}
+	}
+	report, err := runCompoundReport(r, args)
+	if err != nil {
+		return err
+	}
+	var commodities []string
+	seen := map[string]bool{}
+	for _, sub := range report.Subreports {
+		for _, amounts := range sub.Report.Totals.Amounts {
+			for _, a := range amounts {
+				if !seen[a.Commodity] {
+					seen[a.Commodity] = true
+					commodities = append(commodities, a.Commodity)
 				}
-				result = append(result, amount)
 			}
-			return result
 		}
-		return nil
 	}
 
-	assetsTotals := getTotals("Assets")
-	liabilitiesTotals := getTotals("Liabilities")
-
-	var results []NetWorth
-	for i, dateRange := range cbrDates {
-		drSlice, ok := dateRange.([]interface{})
-		if !ok || len(drSlice) == 0 {
-			continue
+	for _, commodity := range commodities {
+		args := append([]string{}, cmdArgs...)
+		args = append(args, "cur:^"+regexp.QuoteMeta(commodity)+"$")
+		report, err := runCompoundReport(r, args)
+		if err != nil {
+			return err
 		}
-		lastDateObj, ok := drSlice[len(drSlice)-1].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		dateStr, ok := lastDateObj["contents"].(string)
-		if !ok {
-			continue
+		name := commodity
+		if name == "" {
+			name = "(no commodity)"
 		}
-
-		assetVal, currency := 0.0, config.Cfg.BaseCurrency
-
-		if i < len(assetsTotals) && assetsTotals[i] != nil {
-			aquantity, ok := assetsTotals[i]["aquantity"].(map[string]interface{})
-			if ok {
-				assetVal, _ = aquantity["floatingPoint"].(float64)
-			}
-			if comm, ok := assetsTotals[i]["acommodity"].(string); ok {
-				currency = comm
+		for _, sub := range report.Subreports {
+			sign := 1.0
+			if strings.EqualFold(sub.Name, "Liabilities") {
+				sign = -1
+			} else if !strings.EqualFold(sub.Name, "Assets") {
+				continue
 			}
+			addBreakdown(results, report.Dates, name, sign, sub.Report.Totals.Amounts)
 		}
+	}
+	return nil
+}
 
-		liabVal := 0.0
-		if i < len(liabilitiesTotals) && liabilitiesTotals[i] != nil {
-			aquantity, ok := liabilitiesTotals[i]["aquantity"].(map[string]interface{})
-			if ok {
-				liabVal, _ = aquantity["floatingPoint"].(float64)
-			}
+// addBreakdown adds sign times the base currency value of each period to
+// the breakdown entry name of the matching point.
+func addBreakdown(results []NetWorth, dates []hledger.DateSpan, name string, sign float64, amounts []hledger.MixedAmount) {
+	byDate := map[string]*NetWorth{}
+	for i := range results {
+		byDate[results[i].Date] = &results[i]
+	}
+	for i, span := range dates {
+		point, ok := byDate[span.End]
+		if !ok || i >= len(amounts) {
+			continue
 		}
+		if point.Breakdown == nil {
+			point.Breakdown = map[string]float64{}
+		}
+		point.Breakdown[name] += sign * baseAmount(amounts[i])
+	}
+}
 
-		results = append(results, NetWorth{
-			Date:     dateStr,
-			Networth: assetVal - liabVal,
-			Currency: currency,
-		})
+// baseAmount returns the base currency part of a valued amount. Commodities
+// without a price to the base currency can't be added to it and are left
+// out.
+func baseAmount(m hledger.MixedAmount) float64 {
+	total := 0.0
+	for _, a := range m {
+		if a.Commodity == config.Cfg.BaseCurrency {
+			total += a.Quantity.FloatingPoint
+		}
 	}
+	return total
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+func runCompoundReport(r *http.Request, args []string) (*hledger.CompoundReport, error) {
+	output, err := runHledger(r, args)
+	if err != nil {
+		return nil, err
+	}
+	return hledger.DecodeCompoundReport(output)
 }
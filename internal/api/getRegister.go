@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
+)
+
+// MaxRegisterRows bounds the limit of one /api/register page.
+const MaxRegisterRows = 1000
+
+// getRegister returns the postings of an account and its subaccounts
+// with running balances, like `hledger register -H`: the balance includes
+// everything before startDate. Rows come a page at a time, oldest first
+// or newest first with order=desc.
+func getRegister(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	account := query.Get("account")
+	startDate := query.Get("startDate")
+	endDate := query.Get("endDate")
+	value := query.Get("valueMode")
+	if account == "" {
+		http.Error(w, "account is required", http.StatusBadRequest)
+		return
+	}
+	if value != "" && value != "then" && value != "now" && value != "end" {
+		http.Error(w, "Invalid value mode. Allowed options are then/now/end.", http.StatusBadRequest)
+		return
+	}
+	offset, limit, err := page(query.Get("offset"), query.Get("limit"), 100, MaxRegisterRows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "Invalid order. Allowed options are asc/desc.", http.StatusBadRequest)
+		return
+	}
+
+	files, expr, err := fileselector.GetRequiredFiles(startDate, endDate, fileArg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the account and its subaccounts, but not accounts that merely start
+	// with the same text
+	accountQuery := "acct:^" + regexp.QuoteMeta(account) + "(:|$)"
+	accountRe := regexp.MustCompile("(?i)^" + regexp.QuoteMeta(account) + "(:|$)")
+
+	var rows []hledger.RegisterRow
+	txs := map[int]hledger.Transaction{}
+	if config.UseNativeBackend() {
+		rows, err = nativeRegister(files, expr, accountQuery, startDate, endDate, value, txs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var args []string
+		if startDate != "" {
+			args = append(args, "-b", startDate)
+		}
+		if endDate != "" {
+			args = append(args, "-e", endDate)
+		}
+		for _, f := range files {
+			args = append(args, "-f", f)
+		}
+		args = append(args, accountQuery)
+		if expr != "" {
+			args = append(args, expr)
+		}
+
+		regArgs := append([]string{"register", "-H", "-O", "json"}, args...)
+		if value != "" {
+			regArgs = append(regArgs, "--value="+value+","+config.Cfg.BaseCurrency)
+		}
+		out, err := runHledger(r, regArgs)
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		if rows, err = hledger.DecodeRegister(out); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the transactions, for the other accounts of each posting
+		out, err = runHledger(r, append([]string{"print", "-O", "json"}, args...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		printed, err := hledger.DecodeTransactions(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, tx := range printed {
+			txs[tx.Index] = tx
+		}
+	}
+
+	type Row struct {
+		Date          string   `json:"date"`
+		Description   string   `json:"description"`
+		TransactionID int      `json:"transactionId"`
+		Account       string   `json:"account"`
+		Status        string   `json:"status"`
+		Amount        []Amount `json:"amount"`
+		Balance       []Amount `json:"balance"`
+		Counterparts  []string `json:"counterparts"`
+	}
+	resp := struct {
+		Account string   `json:"account"`
+		Total   int      `json:"total"`
+		Offset  int      `json:"offset"`
+		Limit   int      `json:"limit"`
+		Balance []Amount `json:"balance"` // at the end of the register
+		Rows    []Row    `json:"rows"`
+	}{Account: account, Total: len(rows), Offset: offset, Limit: limit, Balance: []Amount{}, Rows: []Row{}}
+	if len(rows) > 0 {
+		resp.Balance = toAmounts(rows[len(rows)-1].Total)
+	}
+
+	// the description and date are only on the first posting of each
+	// transaction, keep them for the others
+	for i := 1; i < len(rows); i++ {
+		if rows[i].Date == nil {
+			rows[i].Date, rows[i].Description = rows[i-1].Date, rows[i-1].Description
+		}
+	}
+	if order == "desc" {
+		slices.Reverse(rows)
+	}
+
+	// offset+limit can overflow, so the end is counted from the start
+	start := min(offset, len(rows))
+	for _, row := range rows[start : start+min(limit, len(rows)-start)] {
+		p := row.Posting
+		id, _ := strconv.Atoi(p.TransactionIndex)
+		out := Row{
+			Date:          deref(row.Date),
+			Description:   deref(row.Description),
+			TransactionID: id,
+			Account:       p.Account,
+			Status:        p.Status,
+			Amount:        toAmounts(p.Amount),
+			Balance:       toAmounts(row.Total),
+			Counterparts:  []string{},
+		}
+		if tx, ok := txs[id]; ok {
+			out.Date, out.Description = tx.Date, tx.Description
+			// postings take the transaction's status unless they have one
+			if out.Status == "" || out.Status == "Unmarked" {
+				out.Status = tx.Status
+			}
+			for _, other := range tx.Postings {
+				if !accountRe.MatchString(other.Account) && !slices.Contains(out.Counterparts, other.Account) {
+					out.Counterparts = append(out.Counterparts, other.Account)
+				}
+			}
+		}
+		if p.Date != nil {
+			out.Date = *p.Date
+		}
+		resp.Rows = append(resp.Rows, out)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// nativeRegister is `hledger register -H -O json` with the same options,
+// read with the native parser. The transactions of the rows are added to
+// txs by index.
+func nativeRegister(files []string, expr, accountQuery, startDate, endDate, value string, txs map[int]hledger.Transaction) ([]hledger.RegisterRow, error) {
+	j, f, err := readJournal(files, expr)
+	if err != nil {
+		return nil, err
+	}
+	q, err := journal.ParseQuery([]string{accountQuery})
+	if err != nil {
+		return nil, err
+	}
+	f.Accounts = q.Accounts
+	var begin time.Time
+	if startDate != "" {
+		if begin, err = time.Parse("2006-01-02", startDate); err != nil {
+			return nil, fmt.Errorf("invalid start date: %w", err)
+		}
+	}
+	if endDate != "" {
+		if f.End, err = time.Parse("2006-01-02", endDate); err != nil {
+			return nil, fmt.Errorf("invalid end date: %w", err)
+		}
+	}
+	valueEnd := time.Now()
+	if !f.End.IsZero() {
+		valueEnd = f.End.AddDate(0, 0, -1)
+	}
+
+	// the balance is historical, so postings before the start count too,
+	// and amounts are valued one by one, like hledger sums them
+	var rows []hledger.RegisterRow
+	var total journal.MixedAmount
+	for _, row := range j.Register(f) {
+		tx := *row.Transaction
+		p := *row.Posting
+		amounts := make([]journal.Amount, len(p.Amounts))
+		for k, a := range p.Amounts {
+			amounts[k] = nativeValue(j, a, value, tx.Date, valueEnd)
+			total = total.Add(amounts[k])
+		}
+		if tx.Date.Before(begin) {
+			continue
+		}
+		p.Amounts = amounts
+
+		date := tx.Date.Format("2006-01-02")
+		rows = append(rows, hledger.RegisterRow{
+			Date:        &date,
+			Description: &tx.Description,
+			Posting:     toHledgerPosting(tx, p),
+			Total:       toHledgerMixed(total),
+		})
+		txs[tx.Index] = toHledgerTransaction(tx)
+	}
+	return rows, nil
+}
+
+// page reads offset and limit query parameters. limit defaults to def and
+// may not be more than maxLimit.
+func page(offsetParam, limitParam string, def, maxLimit int) (int, int, error) {
+	offset, limit := 0, def
+	var err error
+	if offsetParam != "" {
+		if offset, err = strconv.Atoi(offsetParam); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", offsetParam)
+		}
+	}
+	if limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("invalid limit %q, use 1 to %d", limitParam, maxLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
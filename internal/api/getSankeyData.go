@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"math"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 
 	"github.com/azbashar/teka/internal/config"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
 )
 
 type SankeyNode struct {
@@ -29,30 +29,9 @@ type SankeyResponse struct {
 	Links []SankeyLink `json:"links"`
 }
 
-// Helper function to get Net Income (Remains Unchanged)
-func getNetIncome(isData map[string]any) (float64, error) {
-	// ... (Implementation for getNetIncome remains the same) ...
-	getAmount := func(arr any, i int) float64 {
-		if arrList, ok := arr.([]any); ok && len(arrList) > i {
-			if inner, ok := arrList[i].([]any); ok && len(inner) > 0 {
-				if amtMap, ok := inner[0].(map[string]any); ok {
-					if aq, ok := amtMap["aquantity"].(map[string]any); ok {
-						if fp, ok := aq["floatingPoint"].(float64); ok {
-							return fp
-						}
-					}
-				}
-			}
-		}
-		return 0
-	}
-
-	cbrTotals, ok := isData["cbrTotals"].(map[string]any)
-	if !ok {
-		return 0, fmt.Errorf("cbrTotals not found in income statement data")
-	}
-
-	netIncome := getAmount(cbrTotals["prrAmounts"], 0)
+// Helper function to get Net Income
+func getNetIncome(isData *hledger.CompoundReport) (float64, error) {
+	netIncome := isData.Totals.Period(0).First().Quantity.FloatingPoint
 	if netIncome != 0 {
 		return netIncome, nil
 	}
@@ -103,16 +82,15 @@ func getSankeyData(w http.ResponseWriter, r *http.Request) {
 		isArgs = append(isArgs, "-e", endDate)
 	}
 
-	isOut, err := exec.Command("hledger", isArgs...).CombinedOutput()
+	isOut, err := runHledger(r, isArgs)
 	if err != nil {
-		fmt.Println(string(isOut))
-		http.Error(w, fmt.Sprintf("hledger income statement error: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("income statement: %v", err), hledgerStatus(err))
 		return
 	}
 
-	var isData map[string]any
-	if err := json.Unmarshal(isOut, &isData); err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse income statement: %v", err), http.StatusInternalServerError)
+	isData, err := hledger.DecodeCompoundReport(isOut)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -134,16 +112,15 @@ func getSankeyData(w http.ResponseWriter, r *http.Request) {
 		bsArgs = append(bsArgs, "-e", endDate)
 	}
 
-	bsOut, err := exec.Command("hledger", bsArgs...).CombinedOutput()
+	bsOut, err := runHledger(r, bsArgs)
 	if err != nil {
-		fmt.Println(string(bsOut))
-		http.Error(w, fmt.Sprintf("hledger balance sheet error: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("balance sheet: %v", err), hledgerStatus(err))
 		return
 	}
 
-	var bsData map[string]any
-	if err := json.Unmarshal(bsOut, &bsData); err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse balance sheet: %v", err), http.StatusInternalServerError)
+	bsData, err := hledger.DecodeCompoundReport(bsOut)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -203,21 +180,12 @@ func getSankeyData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Helper to get floatingPoint amount safely (Remains Unchanged)
-	getAmount := func(arr any, i int) float64 {
-		// ... (Implementation for getAmount remains the same) ...
-		if arrList, ok := arr.([]any); ok && len(arrList) > i {
-			if inner, ok := arrList[i].([]any); ok && len(inner) > 0 {
-				if amtMap, ok := inner[0].(map[string]any); ok {
-					if aq, ok := amtMap["aquantity"].(map[string]any); ok {
-						if fp, ok := aq["floatingPoint"].(float64); ok {
-							return fp
-						}
-					}
-				}
-			}
+	// Helper to get the first amount of a period safely
+	getAmount := func(amounts []hledger.MixedAmount, i int) float64 {
+		if i >= len(amounts) {
+			return 0
 		}
-		return 0
+		return amounts[i].First().Quantity.FloatingPoint
 	}
 
 	// --- Recursive hierarchy builder with SPLIT NODE LOGIC ---
@@ -347,113 +315,86 @@ func getSankeyData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// --- Income/Expenses Processing (Uses Simple Hierarchy Builder) ---
-	var incomeRows, expenseRows []any
+	var incomeRows, expenseRows []hledger.ReportRow
 	var rootIncomeName, rootExpenseName string
 	expenseTotal := 0.0
 	var incomeTotal float64 = 0.0
 
 	// ... (I/E data extraction and linking remains the same as provided) ...
-	if subs, ok := isData["cbrSubreports"].([]any); ok {
-		for _, sub := range subs {
-			subArr, _ := sub.([]any)
-			if len(subArr) < 2 {
-				continue
+	for _, sub := range isData.Subreports {
+		rows := sub.Report.Rows
+		switch sub.Name {
+		case "Revenues":
+			incomeRows = rows
+			if len(rows) > 0 {
+				rootIncomeName = strings.Split(rows[0].Name, ":")[0]
 			}
-			name := subArr[0].(string)
-			data := subArr[1].(map[string]any)
-			rows := data["prRows"].([]any)
-			switch name {
-			case "Revenues":
-				incomeRows = rows
-				if len(rows) > 0 {
-					rootIncomeName = strings.Split(rows[0].(map[string]any)["prrName"].(string), ":")[0]
-				}
-				if prTotals, ok := data["prTotals"].(map[string]any); ok {
-					incomeTotal = getAmount(prTotals["prrAmounts"], 0)
-				}
-			case "Expenses":
-				expenseRows = rows
-				if len(rows) > 0 {
-					rootExpenseName = strings.Split(rows[0].(map[string]any)["prrName"].(string), ":")[0]
-				}
-				if prTotals, ok := data["prTotals"].(map[string]any); ok {
-					expenseTotal = getAmount(prTotals["prrAmounts"], 0)
-				}
+			incomeTotal = getAmount(sub.Report.Totals.Amounts, 0)
+		case "Expenses":
+			expenseRows = rows
+			if len(rows) > 0 {
+				rootExpenseName = strings.Split(rows[0].Name, ":")[0]
 			}
+			expenseTotal = getAmount(sub.Report.Totals.Amounts, 0)
 		}
+	}
 
-		for _, row := range incomeRows {
-			r := row.(map[string]any)
-			name := r["prrName"].(string)
-			val := getAmount(r["prrAmounts"], 0)
-			addRowWithHierarchy(name, val, false) // Child -> Parent
-		}
-		for _, row := range expenseRows {
-			r := row.(map[string]any)
-			name := r["prrName"].(string)
-			val := getAmount(r["prrAmounts"], 0)
-			addRowWithHierarchy(name, val, true) // Parent -> Child
-		}
-		if len(incomeRows) > 0 && len(expenseRows) > 0 {
-			rootIncomeIdx := addNode(rootIncomeName)
-			rootExpenseIdx := addNode(rootExpenseName)
-			flowValue := incomeTotal
-			if incomeTotal > expenseTotal {
-				flowValue = expenseTotal
-			}
-			addLink(rootIncomeIdx, rootExpenseIdx, flowValue)
+	for _, row := range incomeRows {
+		addRowWithHierarchy(row.Name, getAmount(row.Amounts, 0), false) // Child -> Parent
+	}
+	for _, row := range expenseRows {
+		addRowWithHierarchy(row.Name, getAmount(row.Amounts, 0), true) // Parent -> Child
+	}
+	if len(incomeRows) > 0 && len(expenseRows) > 0 {
+		rootIncomeIdx := addNode(rootIncomeName)
+		rootExpenseIdx := addNode(rootExpenseName)
+		flowValue := incomeTotal
+		if incomeTotal > expenseTotal {
+			flowValue = expenseTotal
 		}
+		addLink(rootIncomeIdx, rootExpenseIdx, flowValue)
 	}
 
 	// --- Assets/Liabilities Processing (Uses Split Node Hierarchy Builder) ---
 	var rootLiabilityName, rootAssetName string
 	var totalLiabilityChange float64 = 0.0
 
-	if subs, ok := bsData["cbrSubreports"].([]any); ok {
-		for _, sub := range subs {
-			subArr, _ := sub.([]any)
-			if len(subArr) < 2 {
-				continue
+	for _, sub := range bsData.Subreports {
+		rows := sub.Report.Rows
+
+		switch sub.Name {
+		case "Liabilities":
+			if len(rows) > 0 {
+				rootLiabilityName = strings.Split(rows[0].Name, ":")[0]
 			}
-			name := subArr[0].(string)
-			data := subArr[1].(map[string]any)
-			rows := data["prRows"].([]any)
-
-			switch name {
-			case "Liabilities":
-				if len(rows) > 0 {
-					rootLiabilityName = strings.Split(rows[0].(map[string]any)["prrName"].(string), ":")[0]
-				}
-			case "Assets":
-				if len(rows) > 0 {
-					rootAssetName = strings.Split(rows[0].(map[string]any)["prrName"].(string), ":")[0]
-				}
+		case "Assets":
+			if len(rows) > 0 {
+				rootAssetName = strings.Split(rows[0].Name, ":")[0]
 			}
+		}
 
-			for _, row := range rows {
-				r := row.(map[string]any)
-				name := r["prrName"].(string)
-				val := getAmount(r["prrAmounts"], 0)
+		for _, row := range rows {
+			name := row.Name
+			val := getAmount(row.Amounts, 0)
 
-				if name == rootAssetName || name == rootLiabilityName {
-					addNode(name)
-					continue
-				}
+			if name == rootAssetName || name == rootLiabilityName {
+				addNode(name)
+				continue
+			}
 
-				var direction bool
-				if strings.HasPrefix(name, rootAssetName) && rootAssetName != "" {
-					direction = val >= 0 // ASSETS: Positive val (increase) is use of funds (true), Negative val (decrease) is source of funds (false).
-				} else if strings.HasPrefix(name, rootLiabilityName) && rootLiabilityName != "" {
-					direction = val < 0 // LIABILITIES: Positive val (increase) is source of funds (false), Negative val (decrease) is use of funds (true).
-				} else {
-					direction = true
-				}
+			var direction bool
+			if strings.HasPrefix(name, rootAssetName) && rootAssetName != "" {
+				direction = val >= 0 // ASSETS: Positive val (increase) is use of funds (true), Negative val (decrease) is source of funds (false).
+			} else if strings.HasPrefix(name, rootLiabilityName) && rootLiabilityName != "" {
+				direction = val < 0 // LIABILITIES: Positive val (increase) is source of funds (false), Negative val (decrease) is use of funds (true).
+			} else {
+				direction = true
+			}
 
-				addBalanceSheetHierarchy(name, val, direction)
+			addBalanceSheetHierarchy(name, val, direction)
 
-				if name != rootLiabilityName && rootLiabilityName != "" && strings.HasPrefix(name, rootLiabilityName) {
-					totalLiabilityChange += val
-				}
+			if name != rootLiabilityName && rootLiabilityName != "" && strings.HasPrefix(name, rootLiabilityName) {
+				totalLiabilityChange += val
 			}
 		}
 	}
@@ -621,14 +562,7 @@ func getSankeyData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// currency from data
-	currency := "" // Default currency
-	if len(isData["cbrTotals"].(map[string]any)["prrAmounts"].([]any)) > 0 {
-		if amtData, ok := isData["cbrTotals"].(map[string]any)["prrAmounts"].([]any)[0].([]any)[0].(map[string]any); ok {
-			if comm, ok := amtData["acommodity"].(string); ok {
-				currency = comm
-			}
-		}
-	}
+	currency := isData.Totals.Period(0).First().Commodity
 
 	// --- shorten node names (remove parent chain)
 	for i := range nodes {
@@ -1,15 +1,27 @@
 package api
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/azbashar/teka/internal/config"
 	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
 )
 
+// MaxTransactionRows bounds the limit of one /api/transactions page.
+const MaxTransactionRows = 1000
+
+// getTransactions lists the transactions matching an hledger query, with
+// their count and the sums of the matched postings. Transactions are in
+// date order unless sort and order say otherwise, all of them or the page
+// offset and limit select.
 func getTransactions(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w, r)
 	if r.Method != http.MethodGet {
@@ -17,32 +29,53 @@ func getTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	startDate := r.URL.Query().Get("startDate")
-	endDate := r.URL.Query().Get("endDate")
-	account := r.URL.Query().Get("account")
-	value := r.URL.Query().Get("valueMode")
-	cost := r.URL.Query().Get("cost")
+	query := r.URL.Query()
+	startDate := query.Get("startDate")
+	endDate := query.Get("endDate")
+	account := query.Get("account")
+	value := query.Get("valueMode")
+	cost := query.Get("cost")
+	sortKey := query.Get("sort")
+	order := query.Get("order")
+
+	terms, err := queryTerms(query.Get("query"), account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sortKey != "" && sortKey != "date" && sortKey != "description" && sortKey != "amount" {
+		http.Error(w, "Invalid sort. Allowed options are date/description/amount.", http.StatusBadRequest)
+		return
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "Invalid order. Allowed options are asc/desc.", http.StatusBadRequest)
+		return
+	}
+	// without a limit every transaction is returned
+	offset, limit, err := page(query.Get("offset"), query.Get("limit"), 0, MaxTransactionRows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Build hledger command
-	cmdArgs := []string{"print", "-O", "json"}
+	var filterArgs []string
 
 	if startDate != "" {
-		cmdArgs = append(cmdArgs, "-b", startDate)
+		filterArgs = append(filterArgs, "-b", startDate)
 	}
 	if endDate != "" {
-		cmdArgs = append(cmdArgs, "-e", endDate)
-	}
-	if account != "" {
-		cmdArgs = append(cmdArgs, account)
+		filterArgs = append(filterArgs, "-e", endDate)
 	}
+	filterArgs = append(filterArgs, terms...)
 	if value == "then" || value == "now" || value == "end" {
-		cmdArgs = append(cmdArgs, "--value="+value+","+config.Cfg.BaseCurrency)
+		filterArgs = append(filterArgs, "--value="+value+","+config.Cfg.BaseCurrency)
 	} else if value != "" {
 		http.Error(w, "Invalid value mode. Allowed options are then/now/end.", http.StatusBadRequest)
 		return
 	}
 	if cost == "true" {
-		cmdArgs = append(cmdArgs, "--cost")
+		filterArgs = append(filterArgs, "--cost")
 	}
 
 	files, expr, err := fileselector.GetRequiredFiles(startDate, endDate, fileArg)
@@ -51,26 +84,61 @@ func getTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for _, f := range files {
-		cmdArgs = append(cmdArgs, "-f", f)
+		filterArgs = append(filterArgs, "-f", f)
 	}
 	if expr != "" {
-		cmdArgs = append(cmdArgs, expr)
+		filterArgs = append(filterArgs, expr)
 	}
 
-	// Run hledger
-	out, err := exec.Command("hledger", cmdArgs...).CombinedOutput()
-	if err != nil {
-		fmt.Println(string(out))
-		http.Error(w, err.Error()+": "+string(out), http.StatusInternalServerError)
-		return
+	var txs []hledger.Transaction
+	var sums hledger.MixedAmount
+	if config.UseNativeBackend() {
+		q, err := journal.ParseQuery(terms)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		txs, sums, err = nativeTransactions(files, expr, startDate, endDate, q, value, cost == "true")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// Run hledger
+		out, err := runHledger(r, append([]string{"print", "-O", "json"}, filterArgs...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+
+		txs, err = hledger.DecodeTransactions(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the total of a flat balance report sums the matched postings
+		out, err = runHledger(r, append([]string{"bal", "-O", "json"}, filterArgs...))
+		if err != nil {
+			http.Error(w, err.Error(), hledgerStatus(err))
+			return
+		}
+		report, err := hledger.DecodeBalanceReport(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sums = report.Total
 	}
 
-	// Parse JSON into generic slice
-	var raw []map[string]any
-	if err := json.Unmarshal(out, &raw); err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse hledger output: %v", err), http.StatusInternalServerError)
-		return
+	total := len(txs)
+	sortTransactions(txs, sortKey, order == "desc", config.Cfg.BaseCurrency)
+	if limit == 0 {
+		limit = total
 	}
+	// offset+limit can overflow, so the end is counted from the start
+	start := min(offset, total)
+	txs = txs[start : start+min(limit, total-start)]
 
 	type Tag struct {
 		Key   string `json:"key"`
@@ -104,21 +172,21 @@ func getTransactions(w http.ResponseWriter, r *http.Request) {
 		Status      string    `json:"status"`
 		Doc         Doc       `json:"doc"`
 		Postings    []Posting `json:"postings"`
+		Source      *source   `json:"source"`
 	}
 	resp := struct {
 		Transactions []Transaction `json:"transactions"`
-	}{}
+		Total        int           `json:"total"`
+		Offset       int           `json:"offset"`
+		Limit        int           `json:"limit"`
+		Sums         []Amount      `json:"sums"` // of the matched postings
+	}{Total: total, Offset: offset, Limit: limit, Sums: toAmounts(sums)}
 
-	for _, tx := range raw {
+	found := sources{}
+	for _, tx := range txs {
 		tags := []Tag{}
-		if tt, ok := tx["ttags"].([]any); ok {
-			for _, kv := range tt {
-				if pair, ok := kv.([]any); ok && len(pair) == 2 {
-					key, _ := pair[0].(string)
-					val, _ := pair[1].(string)
-					tags = append(tags, Tag{Key: key, Value: val})
-				}
-			}
+		for _, t := range tx.Tags {
+			tags = append(tags, Tag{Key: t.Key, Value: t.Value})
 		}
 
 		doc := Doc{Attached: false}
@@ -130,78 +198,213 @@ func getTransactions(w http.ResponseWriter, r *http.Request) {
 		}
 
 		postings := []Posting{}
-		if ps, ok := tx["tpostings"].([]any); ok {
-			for _, p := range ps {
-				if pmap, ok := p.(map[string]any); ok {
-					acc, _ := pmap["paccount"].(string)
-					status, _ := pmap["pstatus"].(string)
-					comment, _ := pmap["pcomment"].(string)
-
-					amount := 0.0
-					commodity := ""
-					costData := Cost{HasCost: false}
-
-					if amounts, ok := pmap["pamount"].([]any); ok && len(amounts) > 0 {
-						if am, ok := amounts[0].(map[string]any); ok {
-							if aq, ok := am["aquantity"].(map[string]any); ok {
-								amount, _ = aq["floatingPoint"].(float64)
-							}
-							if comm, ok := am["acommodity"].(string); ok {
-								commodity = comm
-							}
-							if c, ok := am["acost"].(map[string]any); ok {
-								if inner, ok := c["contents"].(map[string]any); ok {
-									cc := Cost{HasCost: true}
-									if aq, ok := inner["aquantity"].(map[string]any); ok {
-										cc.Amount, _ = aq["floatingPoint"].(float64)
-									}
-									if comm, ok := inner["acommodity"].(string); ok {
-										cc.Commodity = comm
-									}
-									costData = cc
-								}
-							}
-						}
-					}
+		for _, p := range tx.Postings {
+			amount := 0.0
+			commodity := ""
+			costData := Cost{HasCost: false}
 
-					// posting tags
-					ptags := []Tag{}
-					if tlist, ok := pmap["ptags"].([]any); ok {
-						for _, kv := range tlist {
-							if pair, ok := kv.([]any); ok && len(pair) == 2 {
-								key, _ := pair[0].(string)
-								val, _ := pair[1].(string)
-								ptags = append(ptags, Tag{Key: key, Value: val})
-							}
-						}
+			if len(p.Amount) > 0 {
+				am := p.Amount.First()
+				amount = am.Quantity.FloatingPoint
+				commodity = am.Commodity
+				if am.Cost != nil {
+					costData = Cost{
+						HasCost:   true,
+						Amount:    am.Cost.Amount.Quantity.FloatingPoint,
+						Commodity: am.Cost.Amount.Commodity,
 					}
-
-					postings = append(postings, Posting{
-						Account:   acc,
-						Amount:    amount,
-						Commodity: commodity,
-						Cost:      costData,
-						Comment:   comment,
-						Status:    status,
-						Tags:      ptags,
-					})
 				}
 			}
+
+			// posting tags
+			ptags := []Tag{}
+			for _, t := range p.Tags {
+				ptags = append(ptags, Tag{Key: t.Key, Value: t.Value})
+			}
+
+			postings = append(postings, Posting{
+				Account:   p.Account,
+				Amount:    amount,
+				Commodity: commodity,
+				Cost:      costData,
+				Comment:   p.Comment,
+				Status:    p.Status,
+				Tags:      ptags,
+			})
 		}
 
 		resp.Transactions = append(resp.Transactions, Transaction{
-			ID:          int(tx["tindex"].(float64)),
-			Date:        tx["tdate"].(string),
-			Description: tx["tdescription"].(string),
+			ID:          tx.Index,
+			Date:        tx.Date,
+			Description: tx.Description,
 			Tags:        tags,
-			Comment:     tx["tcomment"].(string),
-			Code:        tx["tcode"].(string),
-			Status:      tx["tstatus"].(string),
+			Comment:     tx.Comment,
+			Code:        tx.Code,
+			Status:      tx.Status,
 			Doc:         doc,
 			Postings:    postings,
+			Source:      found.of(tx),
 		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// queryTerms splits the query parameter into hledger query terms, with
+// the account as one more. The terms are passed to hledger as arguments,
+// so one starting with - is rejected: it would be taken for an option,
+// like -f or -o that read and write other files.
+func queryTerms(query, account string) ([]string, error) {
+	terms, err := journal.QueryTerms(query)
+	if err != nil {
+		return nil, err
+	}
+	if account != "" {
+		terms = append(terms, account)
+	}
+	for _, t := range terms {
+		if strings.HasPrefix(t, "-") {
+			return nil, fmt.Errorf("invalid query term %q, terms can't start with -", t)
+		}
+	}
+	return terms, nil
+}
+
+// nativeTransactions is `hledger print` with the same options, read with
+// the native parser, and the sums of the matched postings. Amounts without
+// a market price are left as they are.
+func nativeTransactions(files []string, expr, startDate, endDate string, q journal.Filter, value string, cost bool) ([]hledger.Transaction, hledger.MixedAmount, error) {
+	j, f, err := readJournal(files, expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	q.Transaction = f.Transaction
+	f = q
+	if startDate != "" {
+		if f.Begin, err = time.Parse("2006-01-02", startDate); err != nil {
+			return nil, nil, fmt.Errorf("invalid start date: %w", err)
+		}
+	}
+	if endDate != "" {
+		if f.End, err = time.Parse("2006-01-02", endDate); err != nil {
+			return nil, nil, fmt.Errorf("invalid end date: %w", err)
+		}
+	}
+
+	// --value=end uses prices at the end of the report, or today
+	valueEnd := time.Now()
+	if !f.End.IsZero() {
+		valueEnd = f.End.AddDate(0, 0, -1)
+	}
+
+	txs := []hledger.Transaction{}
+	var sums journal.MixedAmount
+	for _, tx := range j.Select(f) {
+		tx.Postings = append([]journal.Posting(nil), tx.Postings...)
+		for i := range tx.Postings {
+			p := &tx.Postings[i]
+			matched := f.MatchPosting(&tx, *p)
+			amounts := make([]journal.Amount, len(p.Amounts))
+			for k, a := range p.Amounts {
+				if cost {
+					a = a.AtCost()
+				}
+				amounts[k] = nativeValue(j, a, value, tx.Date, valueEnd)
+				if matched {
+					sums = sums.Add(amounts[k])
+				}
+			}
+			p.Amounts = amounts
+		}
+		txs = append(txs, toHledgerTransaction(tx))
+	}
+	return txs, toHledgerMixed(sums.NonZero().Sorted()), nil
+}
+
+// sortTransactions orders transactions by date, then journal order, by
+// description or by amount, the total of their positive amounts in one
+// commodity (see transactionSize). Amounts in the base currency come
+// first, then the other commodities by name, whichever the order. The
+// sort is stable, so equal keys stay in date order.
+func sortTransactions(txs []hledger.Transaction, key string, desc bool, base string) {
+	dir := 1
+	if desc {
+		dir = -1
+	}
+	var compare func(a, b hledger.Transaction) int
+	switch key {
+	case "description":
+		compare = func(a, b hledger.Transaction) int {
+			return dir * strings.Compare(strings.ToLower(a.Description), strings.ToLower(b.Description))
+		}
+	case "amount":
+		compare = func(a, b hledger.Transaction) int {
+			ca, sa := transactionSize(a, base)
+			cb, sb := transactionSize(b, base)
+			if ca != cb {
+				// amounts in different commodities can't be compared:
+				// the base currency goes first, then by commodity
+				return cmp.Or(compareBool(cb == base, ca == base), strings.Compare(ca, cb))
+			}
+			return dir * cmp.Compare(sa, sb)
+		}
+	default:
+		compare = func(a, b hledger.Transaction) int {
+			if c := strings.Compare(a.Date, b.Date); c != 0 {
+				return dir * c
+			}
+			return dir * (a.Index - b.Index)
+		}
+	}
+	slices.SortStableFunc(txs, compare)
+}
+
+// transactionSize is the total of a transaction's positive amounts in
+// one commodity, the base currency if it has any, or else the commodity of
+// its first positive amount. Amounts in other commodities are left out
+// rather than added up with it.
+func transactionSize(tx hledger.Transaction, base string) (string, float64) {
+	commodity, found := "", false
+	for _, p := range tx.Postings {
+		for _, a := range p.Amount {
+			if a.Quantity.FloatingPoint > 0 && (!found || a.Commodity == base) {
+				commodity, found = a.Commodity, true
+			}
+		}
+	}
+	var size float64
+	for _, p := range tx.Postings {
+		for _, a := range p.Amount {
+			if a.Quantity.FloatingPoint > 0 && a.Commodity == commodity {
+				size += a.Quantity.FloatingPoint
+			}
+		}
+	}
+	return commodity, size
+}
+
+// compareBool orders false before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// nativeValue is an amount with --value=then, now or end. Amounts without
+// a market price, and any amount when value is "", are left as they are.
+func nativeValue(j *journal.Journal, a journal.Amount, value string, date, end time.Time) journal.Amount {
+	switch value {
+	case "then":
+		a, _ = j.Value(a, config.Cfg.BaseCurrency, date)
+	case "now":
+		a, _ = j.Value(a, config.Cfg.BaseCurrency, time.Now())
+	case "end":
+		a, _ = j.Value(a, config.Cfg.BaseCurrency, end)
+	}
+	return a
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/hledger"
+)
+
+func TestQueryTerms(t *testing.T) {
+	terms, err := queryTerms(`desc:'coffee shop' amt:>-50 not:assets`, "expenses:food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"desc:coffee shop", "amt:>-50", "not:assets", "expenses:food"}
+	if !slices.Equal(terms, want) {
+		t.Errorf("queryTerms = %q, want %q", terms, want)
+	}
+
+	for _, c := range []struct{ query, account string }{
+		{"-f /etc/passwd", ""},
+		{"assets --output-file=/tmp/out", ""},
+		{"-o/tmp/out", ""},
+		{"", "-f"},
+		{"", "--output-file=/tmp/out"},
+	} {
+		if terms, err := queryTerms(c.query, c.account); err == nil {
+			t.Errorf("queryTerms(%q, %q) = %q, want an error", c.query, c.account, terms)
+		}
+	}
+}
+
+func TestGetTransactionsRejectsOptions(t *testing.T) {
+	for _, q := range []url.Values{
+		{"query": {"-f /etc/passwd"}},
+		{"query": {"-o /tmp/out"}},
+		{"account": {"--output-file=/tmp/out"}},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/transactions/?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		getTransactions(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", r.URL, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSortTransactionsByAmount(t *testing.T) {
+	tx := func(index int, amounts ...hledger.Amount) hledger.Transaction {
+		var ps []hledger.Posting
+		for _, a := range amounts {
+			ps = append(ps, hledger.Posting{Amount: hledger.MixedAmount{a}})
+		}
+		return hledger.Transaction{Index: index, Postings: ps}
+	}
+	amount := func(q float64, c string) hledger.Amount {
+		return hledger.Amount{Commodity: c, Quantity: hledger.Quantity{FloatingPoint: q}}
+	}
+	for _, c := range []struct {
+		desc bool
+		want []int
+	}{
+		{false, []int{4, 2, 3, 5, 1}},
+		// desc reverses amounts within a commodity, the base currency
+		// still comes first
+		{true, []int{2, 4, 5, 3, 1}},
+	} {
+		txs := []hledger.Transaction{
+			tx(1, amount(5000, "JPY"), amount(-5000, "JPY")),
+			tx(2, amount(20, "USD"), amount(-20, "USD")),
+			tx(3, amount(10, "EUR"), amount(-10, "EUR")),
+			tx(4, amount(5, "USD"), amount(900, "JPY"), amount(-5, "USD"), amount(-900, "JPY")),
+			tx(5, amount(30, "EUR"), amount(-30, "EUR")),
+		}
+		sortTransactions(txs, "amount", c.desc, "USD")
+		var got []int
+		for _, tx := range txs {
+			got = append(got, tx.Index)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("sorted by amount, desc %v: %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestGetTransactionsHugeOffset(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.journal")
+	journal := "2025-01-01 a\n    expenses:food  1 USD\n    assets:cash\n\n" +
+		"2025-01-02 b\n    expenses:food  2 USD\n    assets:cash\n"
+	if err := os.WriteFile(file, []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(cfg config.Config, file string) { config.Cfg, fileArg = cfg, file }(config.Cfg, fileArg)
+	config.Cfg.Backend = "native"
+	fileArg = file
+
+	r := httptest.NewRequest(http.MethodGet, "/api/transactions/?offset=9223372036854775807&limit=1", nil)
+	w := httptest.NewRecorder()
+	getTransactions(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Transactions []json.RawMessage `json:"transactions"`
+		Total        int               `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Transactions) != 0 || resp.Total != 2 {
+		t.Errorf("got %d transactions of %d, want 0 of 2", len(resp.Transactions), resp.Total)
+	}
+}
@@ -1,20 +1,107 @@
 package api
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/azbashar/teka/internal/cache"
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/watcher"
+)
 
 var fileArg, mainFileArg string
 
+var runner hledger.Runner
+
+// execRunner runs hledger without the cache, for the checks after a write.
+var execRunner hledger.Runner
+
+var hledgerCache *cache.Runner
+
+// journalCache keeps the journals native reports read, and the account
+// directives /api/accounts reads with either backend.
+var journalCache = cache.NewJournals()
+
+// runnerConfig is the hledger config the runners were built with.
+var runnerConfig config.Hledger
+
+var fileWatcher *watcher.Watcher
+
+// configMu guards config.Cfg in the server: handlers read it holding the
+// read lock, reloading and updating the config take the write lock, so
+// a new config only takes effect between requests.
+var configMu sync.RWMutex
+
+// withConfig runs a handler holding the read lock on the config.
+func withConfig(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		h(w, r)
+	}
+}
+
 func InitAPI(file, mainFile string) {
 	fileArg = file
 	mainFileArg = mainFile
-	http.HandleFunc("/api/incomestatement/", getIncomeStatement)
-	http.HandleFunc("/api/balancesheet/", getBalanceSheet)
-	http.HandleFunc("/api/accountBalances/", accountBalances)
-	http.HandleFunc("/api/networth/", getNetWorth)
-	http.HandleFunc("/api/getConfig/", getConfig)
+	newRunners()
+
+	configFile, err := config.GetConfigPath()
+	if err != nil {
+		fmt.Println("Error getting config path:", err)
+	}
+	fileWatcher = watcher.New(func() []string {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		return fileselector.GetJournalRoots(fileArg, mainFileArg)
+	}, configFile, watcher.DefaultInterval)
+	fileWatcher.OnConfigChange = func() {
+		configMu.Lock()
+		defer configMu.Unlock()
+		if err := config.LoadConfig(); err != nil {
+			fmt.Println("Error reloading config:", err)
+		}
+		if config.Cfg.Hledger != runnerConfig {
+			newRunners()
+		}
+	}
+	fileWatcher.Start()
+
+	http.HandleFunc("/api/incomestatement/", withConfig(getIncomeStatement))
+	http.HandleFunc("/api/balancesheet/", withConfig(getBalanceSheet))
+	http.HandleFunc("/api/accountBalances/", withConfig(accountBalances))
+	http.HandleFunc("/api/networth/", withConfig(getNetWorth))
+	http.HandleFunc("/api/getConfig/", withConfig(getConfig))
 	http.HandleFunc("/api/updateConfig/", updateConfig)
-	http.HandleFunc("/api/sankey/", getSankeyData)
-	http.HandleFunc("/api/transactions/", getTransactions)
+	http.HandleFunc("/api/sankey/", withConfig(getSankeyData))
+	http.HandleFunc("/api/transactions/", withConfig(transactions))
+	http.HandleFunc("/api/cache/", withConfig(manageCache))
+	http.HandleFunc("/api/events/", streamEvents)
+	http.HandleFunc("/api/docs/", withConfig(getDocument))
+	http.HandleFunc("/api/accounts/", withConfig(getAccounts))
+	http.HandleFunc("/api/register/", withConfig(getRegister))
+}
+
+// newRunners builds the hledger runners and the cache in front of them
+// from the config. It runs again when the hledger path, timeout or process
+// limit change, which starts with an empty cache; callers hold configMu
+// for writing.
+func newRunners() {
+	runnerConfig = config.Cfg.Hledger
+	execRunner = hledger.NewExecRunner(
+		runnerConfig.Path,
+		time.Duration(runnerConfig.TimeoutSeconds)*time.Second,
+		runnerConfig.MaxProcesses,
+	)
+	hledgerCache = cache.New(execRunner)
+	runner = hledgerCache
 }
 
 func enableCORS(w http.ResponseWriter, r *http.Request) {
@@ -26,3 +113,51 @@ func enableCORS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// sameOrigin rejects a write sent from a page another site serves. The
+// wildcard CORS headers only cover reads; browsers send Origin with writes,
+// and a request without one does not come from a page.
+func sameOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+		http.Error(w, "Cross-origin writes are not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// jsonBody rejects a write whose body is not sent as JSON, which a form on
+// another site cannot do without a preflight.
+func jsonBody(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// runHledger runs hledger for the request, so it is stopped when the client
+// goes away. Warnings hledger prints on stderr are logged, not returned.
+func runHledger(r *http.Request, args []string) ([]byte, error) {
+	stdout, stderr, err := runner.Run(r.Context(), args)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if len(stderr) > 0 {
+		fmt.Println(string(stderr))
+	}
+	return stdout, nil
+}
+
+// hledgerStatus picks the response status for an error from runHledger.
+func hledgerStatus(err error) int {
+	if errors.Is(err, hledger.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
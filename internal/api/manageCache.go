@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// manageCache reports the hledger cache statistics on GET and empties the
+// cache, and the cache of parsed journals, on DELETE.
+func manageCache(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	switch r.Method {
+	case http.MethodOptions:
+		return
+	case http.MethodGet:
+	case http.MethodDelete:
+		hledgerCache.Flush()
+		journalCache.Flush()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hledgerCache.Stats())
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/azbashar/teka/internal/hledger"
+	"github.com/azbashar/teka/internal/journal"
+)
+
+// clopenExpr matches the query fileselector.GetRequiredFiles adds to keep
+// only the first year's closing/opening transactions.
+var clopenExpr = regexp.MustCompile(`^expr:tag:clopen=(\d+) or not tag:clopen$`)
+
+// readJournal parses the files a report needs with the native parser, or
+// takes the journal from the cache while they are unchanged; it is shared,
+// so it must not be changed. The returned filter applies expr, the extra
+// query from fileselector.GetRequiredFiles.
+func readJournal(files []string, expr string) (*journal.Journal, journal.Filter, error) {
+	j, err := journalCache.Parse(files)
+	if err != nil {
+		return nil, journal.Filter{}, err
+	}
+	var f journal.Filter
+	if m := clopenExpr.FindStringSubmatch(expr); m != nil {
+		year := m[1]
+		f.Transaction = func(tx *journal.Transaction) bool {
+			value, ok := tx.Tag("clopen")
+			return !ok || strings.Contains(value, year)
+		}
+	}
+	return j, f, nil
+}
+
+// The native backend answers with the same types the hledger JSON decodes
+// into, so handlers format both the same way.
+
+func toHledgerAmount(a journal.Amount) hledger.Amount {
+	mark := a.Style.DecimalMark
+	if mark == 0 {
+		mark = '.'
+	}
+	side := "R"
+	if a.Style.Side == 'L' {
+		side = "L"
+	}
+	out := hledger.Amount{
+		Commodity: a.Commodity,
+		Quantity: hledger.Quantity{
+			DecimalMantissa: a.Quantity.Mantissa().Int64(),
+			DecimalPlaces:   a.Quantity.Places(),
+			FloatingPoint:   a.Quantity.Float64(),
+		},
+		Style: &hledger.AmountStyle{
+			CommoditySide:   side,
+			CommoditySpaced: a.Style.Spaced,
+			DecimalMark:     string(mark),
+			Precision:       a.Style.Precision,
+		},
+	}
+	if a.Cost != nil {
+		tag := "UnitCost"
+		if a.Cost.Total {
+			tag = "TotalCost"
+		}
+		out.Cost = &hledger.Cost{Tag: tag, Amount: toHledgerAmount(a.Cost.Amount)}
+	}
+	return out
+}
+
+func toHledgerMixed(amounts []journal.Amount) hledger.MixedAmount {
+	out := hledger.MixedAmount{}
+	for _, a := range amounts {
+		out = append(out, toHledgerAmount(a))
+	}
+	return out
+}
+
+var hledgerStatusNames = map[journal.Status]string{
+	journal.Unmarked: "Unmarked",
+	journal.Pending:  "Pending",
+	journal.Cleared:  "Cleared",
+}
+
+var hledgerPostingTypes = map[journal.PostingType]string{
+	journal.RegularPosting:         "RegularPosting",
+	journal.VirtualPosting:         "VirtualPosting",
+	journal.BalancedVirtualPosting: "BalancedVirtualPosting",
+}
+
+func toHledgerTags(tags []journal.Tag) []hledger.Tag {
+	out := []hledger.Tag{}
+	for _, t := range tags {
+		out = append(out, hledger.Tag{Key: t.Name, Value: t.Value})
+	}
+	return out
+}
+
+func toHledgerTransaction(tx journal.Transaction) hledger.Transaction {
+	out := hledger.Transaction{
+		Index:       tx.Index,
+		Date:        tx.Date.Format("2006-01-02"),
+		Description: tx.Description,
+		Code:        tx.Code,
+		Comment:     tx.Comment,
+		Status:      hledgerStatusNames[tx.Status],
+		Tags:        toHledgerTags(tx.Tags),
+		// like hledger, the end position is the line after the entry
+		SourcePos: []hledger.SourcePos{
+			{File: tx.Pos.File, Line: tx.Pos.Line, Column: 1},
+			{File: tx.Pos.File, Line: tx.Pos.EndLine + 1, Column: 1},
+		},
+	}
+	if tx.Date2 != nil {
+		date2 := tx.Date2.Format("2006-01-02")
+		out.Date2 = &date2
+	}
+	for _, p := range tx.Postings {
+		out.Postings = append(out.Postings, toHledgerPosting(tx, p))
+	}
+	return out
+}
+
+func toHledgerPosting(tx journal.Transaction, p journal.Posting) hledger.Posting {
+	return hledger.Posting{
+		Account:          p.Account,
+		Amount:           toHledgerMixed(p.Amounts),
+		Comment:          p.Comment,
+		Status:           hledgerStatusNames[p.Status],
+		Tags:             toHledgerTags(p.Tags),
+		Type:             hledgerPostingTypes[p.Type],
+		TransactionIndex: strconv.Itoa(tx.Index),
+	}
+}
+
+// nativeBalanceReport is `hledger bal --tree --no-total` restricted to the
+// given accounts: each row is the balance including subaccounts.
+func nativeBalanceReport(j *journal.Journal, f journal.Filter, accounts []string) *hledger.BalanceReport {
+	balances := j.Balances(f)
+	report := &hledger.BalanceReport{}
+	for _, account := range accounts {
+		amount := journal.Inclusive(balances, account).NonZero()
+		report.Rows = append(report.Rows, hledger.BalanceRow{
+			Account:     account,
+			DisplayName: account,
+			Amount:      toHledgerMixed(amount),
+		})
+	}
+	return report
+}
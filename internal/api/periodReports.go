@@ -0,0 +1,67 @@
+package api
+
+import (
+	"github.com/azbashar/teka/internal/config"
+	"github.com/azbashar/teka/internal/hledger"
+)
+
+// periodReports turns a compound balance report (bs or is) into one entry
+// per report period, each with its account rows and the period total.
+//
+// Rows and totals carry every commodity in "amounts". "amount" and
+// "currency" hold the first commodity only and are kept for callers that
+// ask for a single currency through valueMode.
+func periodReports(report *hledger.CompoundReport) []map[string]any {
+	var periodReports []map[string]any
+
+	for i, span := range report.Dates {
+		var data []map[string]any
+		totalAmounts := []Amount{}
+
+		for _, sub := range report.Subreports {
+			for _, row := range sub.Report.Rows {
+				periodAmounts := row.Period(i)
+				if len(periodAmounts) == 0 {
+					continue
+				}
+
+				amounts := toAmounts(periodAmounts)
+				totalAmounts = addAmounts(totalAmounts, amounts)
+
+				data = append(data, map[string]any{
+					"account":  row.Name,
+					"amount":   amounts[0].Amount,
+					"currency": amounts[0].Currency,
+					"amounts":  amounts,
+				})
+			}
+		}
+
+		// use the period total from hledger if available
+		if totals := report.Totals.Period(i); len(totals) > 0 {
+			totalAmounts = toAmounts(totals)
+		}
+		periodTotal := map[string]any{
+			"amount":   0.0,
+			"currency": config.Cfg.BaseCurrency,
+			"amounts":  totalAmounts,
+		}
+		if len(totalAmounts) > 0 {
+			periodTotal["amount"] = totalAmounts[0].Amount
+			periodTotal["currency"] = totalAmounts[0].Currency
+		}
+
+		if len(data) > 0 {
+			periodReports = append(periodReports, map[string]any{
+				"dates": map[string]string{
+					"from": span.Start,
+					"to":   span.End,
+				},
+				"total": periodTotal,
+				"data":  data,
+			})
+		}
+	}
+
+	return periodReports
+}
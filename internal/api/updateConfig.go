@@ -29,8 +29,15 @@ func updateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the config changes between requests, see configMu
+	configMu.Lock()
+	defer configMu.Unlock()
+
 	merged := mergeStruct(config.Cfg, partial).(config.Config)
 	config.Cfg = merged
+	if config.Cfg.Hledger != runnerConfig {
+		newRunners()
+	}
 
 	configFile, err := config.GetConfigPath()
 	if err != nil {
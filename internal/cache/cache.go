@@ -0,0 +1,191 @@
+// Package cache keeps hledger output, and journals read with the native
+// parser, in memory until one of the journals they come from changes.
+package cache
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/hledger"
+)
+
+// MaxEntries bounds the number of cached results. The oldest entry is
+// dropped when the cache is full.
+const MaxEntries = 256
+
+// fileState is what we remember about a journal to notice changes.
+type fileState struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+	Missing bool
+}
+
+type entry struct {
+	files  []fileState
+	stdout []byte
+	stderr []byte
+}
+
+// Stats describes the cache for the /api/cache endpoint.
+type Stats struct {
+	Entries       int       `json:"entries"`
+	Bytes         int       `json:"bytes"`
+	Hits          int       `json:"hits"`
+	Misses        int       `json:"misses"`
+	Invalidations int       `json:"invalidations"`
+	LastFlush     time.Time `json:"lastFlush"`
+}
+
+// Runner is a hledger.Runner that answers repeated invocations from memory.
+// Results are keyed by the hledger arguments and stay valid while the
+// modification time and size of every journal involved, including the
+// ones pulled in with include, are unchanged. Failed runs are not cached.
+type Runner struct {
+	next hledger.Runner
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   []string
+	stats   Stats
+}
+
+// New wraps next with a cache.
+func New(next hledger.Runner) *Runner {
+	return &Runner{
+		next:    next,
+		entries: map[string]*entry{},
+		stats:   Stats{LastFlush: time.Now()},
+	}
+}
+
+func (c *Runner) Run(ctx context.Context, args []string) ([]byte, []byte, error) {
+	// hledger resolves relative dates and --value=now against today
+	key := time.Now().Format("2006-01-02") + "\x00" + strings.Join(args, "\x00")
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok {
+		if unchanged(e.files) {
+			c.mu.Lock()
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.stdout, e.stderr, nil
+		}
+		c.mu.Lock()
+		c.stats.Invalidations++
+		c.remove(key)
+		c.mu.Unlock()
+	}
+
+	// stat before running, so a change made while hledger runs is
+	// noticed on the next request
+	files := snapshot(fileselector.WithIncludes(journalArgs(args)))
+	stdout, stderr, err := c.next.Run(ctx, args)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Misses++
+	if err != nil {
+		return stdout, stderr, err
+	}
+	c.remove(key)
+	if len(c.order) >= MaxEntries {
+		c.remove(c.order[0])
+	}
+	c.entries[key] = &entry{files: files, stdout: stdout, stderr: stderr}
+	c.order = append(c.order, key)
+	return stdout, stderr, nil
+}
+
+// Stats returns the current cache statistics.
+func (c *Runner) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = len(c.entries)
+	for _, e := range c.entries {
+		s.Bytes += len(e.stdout) + len(e.stderr)
+	}
+	return s
+}
+
+// Flush drops every cached result.
+func (c *Runner) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*entry{}
+	c.order = nil
+	c.stats.LastFlush = time.Now()
+}
+
+// remove drops key from the cache. c.mu must be held.
+func (c *Runner) remove(key string) {
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// journalArgs returns the files passed with -f/--file, or LEDGER_FILE when
+// there are none, the same way hledger picks them.
+func journalArgs(args []string) []string {
+	var files []string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case (a == "-f" || a == "--file") && i+1 < len(args):
+			files = append(files, args[i+1])
+			i++
+		case strings.HasPrefix(a, "--file="):
+			files = append(files, strings.TrimPrefix(a, "--file="))
+		case strings.HasPrefix(a, "-f") && len(a) > 2:
+			files = append(files, a[2:])
+		}
+	}
+	if len(files) == 0 {
+		if f := os.Getenv("LEDGER_FILE"); f != "" {
+			files = append(files, f)
+		} else {
+			files = append(files, "~/.hledger.journal")
+		}
+	}
+	return files
+}
+
+func snapshot(paths []string) []fileState {
+	states := make([]fileState, 0, len(paths))
+	for _, p := range paths {
+		states = append(states, stat(p))
+	}
+	return states
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{Path: path, Missing: true}
+	}
+	return fileState{Path: path, ModTime: info.ModTime(), Size: info.Size()}
+}
+
+func unchanged(files []fileState) bool {
+	for _, f := range files {
+		now := stat(f.Path)
+		if now.Missing != f.Missing || now.Size != f.Size || !now.ModTime.Equal(f.ModTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/azbashar/teka/internal/fileselector"
+	"github.com/azbashar/teka/internal/journal"
+)
+
+// MaxJournals bounds the number of parsed journals kept. They are much
+// larger than hledger output, so only a few date ranges are kept.
+const MaxJournals = 8
+
+type parsed struct {
+	files   []fileState
+	journal *journal.Journal
+}
+
+// Journals keeps journals read with the native parser until the modification
+// time or size of one of their files changes, like Runner does for hledger
+// output. The journals are shared between callers and must not be changed.
+type Journals struct {
+	mu      sync.Mutex
+	entries map[string]*parsed
+	order   []string
+}
+
+// NewJournals returns an empty journal cache.
+func NewJournals() *Journals {
+	return &Journals{entries: map[string]*parsed{}}
+}
+
+// Parse returns journal.ParseFiles(paths...), from the cache while none of
+// the files or the files they include changed. Errors are not cached.
+func (c *Journals) Parse(paths []string) (*journal.Journal, error) {
+	key := strings.Join(paths, "\x00")
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && unchanged(e.files) {
+		return e.journal, nil
+	}
+
+	// stat before parsing, so a change made meanwhile is noticed next time
+	files := snapshot(fileselector.WithIncludes(paths))
+	j, err := journal.ParseFiles(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+	if len(c.order) >= MaxJournals {
+		c.remove(c.order[0])
+	}
+	c.entries[key] = &parsed{files: files, journal: j}
+	c.order = append(c.order, key)
+	return j, nil
+}
+
+// Flush drops every cached journal.
+func (c *Journals) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*parsed{}
+	c.order = nil
+}
+
+// remove drops key from the cache. c.mu must be held.
+func (c *Journals) remove(key string) {
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
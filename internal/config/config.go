@@ -29,14 +29,40 @@ type StarredAccount struct {
 	Account     string `yaml:"account"`
 }
 
+type Hledger struct {
+	Path           string `yaml:"path"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+	MaxProcesses   int    `yaml:"max_processes"`
+}
+
+type TemplatePosting struct {
+	Account string `yaml:"account"`
+	Amount  string `yaml:"amount"`
+	Comment string `yaml:"comment"`
+}
+
+// Template is a transaction teka add can fill in. Note, accounts and
+// amounts may hold {placeholders} that are asked for when it is used.
+type Template struct {
+	Name     string            `yaml:"name"`
+	Date     string            `yaml:"date"`
+	Note     string            `yaml:"note"`
+	Comment  string            `yaml:"comment"`
+	Postings []TemplatePosting `yaml:"postings"`
+}
+
 type Config struct {
 	BaseCurrency           string                 `yaml:"base_currency"`
 	Locale                 string                 `yaml:"locale"`
 	AmountColumn           int                    `yaml:"amount_column"`
 	Accounts               Accounts               `yaml:"accounts"`
 	StarredAccounts        []StarredAccount       `yaml:"starred_accounts"`
+	StarredComparison      string                 `yaml:"starred_comparison"`
 	EfficientFileStructure EfficientFileStructure `yaml:"efficient_file_structure"`
 	ShowGetStarted         bool                   `yaml:"show_get_started_on_next_launch"`
+	Hledger                Hledger                `yaml:"hledger"`
+	Backend                string                 `yaml:"backend"` // "hledger" or "native"
+	Templates              []Template             `yaml:"templates"`
 }
 
 var Cfg Config
@@ -79,11 +105,18 @@ func LoadConfig() error {
 					{DisplayName: "Cash Wallet", Account: "assets:cash"},
 					{DisplayName: "Bank", Account: "assets:bank"},
 				},
+				StarredComparison: "month",
 				EfficientFileStructure: EfficientFileStructure{
 					Enabled:   false,
 					FilesRoot: "~/finance/",
 				},
 				ShowGetStarted: true,
+				Hledger: Hledger{
+					Path:           "hledger",
+					TimeoutSeconds: 60,
+					MaxProcesses:   4,
+				},
+				Backend: "hledger",
 			}
 			fmt.Println("No config file found.")
 			return SaveConfig(configFile)
@@ -91,13 +124,23 @@ func LoadConfig() error {
 		return err
 	}
 
-	if err := yaml.Unmarshal(data, &Cfg); err != nil {
+	// read into a new value, so a config that fails to parse leaves the
+	// current one as it was
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return fmt.Errorf("invalid config file.\nfailed to parse file: %w", err)
 	}
+	Cfg = cfg
 
 	return nil
 }
 
+// UseNativeBackend reports whether journals are read with Teka's own parser
+// instead of the hledger binary.
+func UseNativeBackend() bool {
+	return Cfg.Backend == "native"
+}
+
 func SaveConfig(configFile string) error {
 	data, err := yaml.Marshal(Cfg)
 	if err != nil {
@@ -0,0 +1,219 @@
+// Package decimal implements the exact decimal numbers journal amounts are
+// made of. A Decimal is an integer mantissa scaled by 10^-places, so 1.50
+// and 1.5 are equal but remember how many decimals they were written with.
+package decimal
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact decimal number. The zero value is 0.
+type Decimal struct {
+	mantissa *big.Int
+	places   int
+}
+
+var ten = big.NewInt(10)
+
+func (d Decimal) m() *big.Int {
+	if d.mantissa == nil {
+		return new(big.Int)
+	}
+	return d.mantissa
+}
+
+// New returns mantissa * 10^-places.
+func New(mantissa int64, places int) Decimal {
+	if places < 0 {
+		m := new(big.Int).Mul(big.NewInt(mantissa), pow10(-places))
+		return Decimal{mantissa: m}
+	}
+	return Decimal{mantissa: big.NewInt(mantissa), places: places}
+}
+
+// Parse reads a plain decimal like "-1234.50". Digit group marks and
+// commodities are handled by the journal parser, not here.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	digits := intPart + fracPart
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("invalid number %q", s)
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("invalid number %q", s)
+		}
+	}
+	m, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		m.Neg(m)
+	}
+	return Decimal{mantissa: m, places: len(fracPart)}, nil
+}
+
+// MustParse is Parse for constants. It panics on invalid input.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+// scaled returns the mantissa of d written with the given number of places,
+// which must not be less than d.places.
+func (d Decimal) scaled(places int) *big.Int {
+	if places == d.places {
+		return d.m()
+	}
+	return new(big.Int).Mul(d.m(), pow10(places-d.places))
+}
+
+// Places is the number of decimals d is written with.
+func (d Decimal) Places() int {
+	return d.places
+}
+
+// Add returns d + o, with the larger number of places of the two.
+func (d Decimal) Add(o Decimal) Decimal {
+	places := max(d.places, o.places)
+	return Decimal{mantissa: new(big.Int).Add(d.scaled(places), o.scaled(places)), places: places}
+}
+
+// Sub returns d - o.
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{mantissa: new(big.Int).Neg(d.m()), places: d.places}
+}
+
+// Abs returns |d|.
+func (d Decimal) Abs() Decimal {
+	return Decimal{mantissa: new(big.Int).Abs(d.m()), places: d.places}
+}
+
+// Mul returns d * o exactly.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{mantissa: new(big.Int).Mul(d.m(), o.m()), places: d.places + o.places}
+}
+
+// Div returns d / o rounded half away from zero to the given places.
+func (d Decimal) Div(o Decimal, places int) (Decimal, error) {
+	if o.IsZero() {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+	// d/o = (dm / 10^dp) / (om / 10^op); scale so the quotient has
+	// places+1 digits after the point, then round the last one away
+	num := new(big.Int).Mul(d.m(), pow10(places+1+o.places))
+	den := new(big.Int).Mul(o.m(), pow10(d.places))
+	q := new(big.Int).Quo(num, den)
+	return Decimal{mantissa: q, places: places + 1}.Round(places), nil
+}
+
+// Round returns d rounded half away from zero to the given places. Numbers
+// with fewer places are returned unchanged.
+func (d Decimal) Round(places int) Decimal {
+	if places >= d.places {
+		return d
+	}
+	div := pow10(d.places - places)
+	q, r := new(big.Int).QuoRem(d.m(), div, new(big.Int))
+	// compare 2*|r| with the divisor to round half away from zero
+	r2 := new(big.Int).Abs(r)
+	r2.Mul(r2, big.NewInt(2))
+	if r2.Cmp(div) >= 0 {
+		if d.m().Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{mantissa: q, places: places}
+}
+
+// WithPlaces returns d written with exactly the given places, rounding
+// when it has more.
+func (d Decimal) WithPlaces(places int) Decimal {
+	if places < d.places {
+		return d.Round(places)
+	}
+	return Decimal{mantissa: d.scaled(places), places: places}
+}
+
+// Normalize drops trailing zero decimals.
+func (d Decimal) Normalize() Decimal {
+	m := new(big.Int).Set(d.m())
+	places := d.places
+	r := new(big.Int)
+	for places > 0 {
+		q, rem := new(big.Int).QuoRem(m, ten, r)
+		if rem.Sign() != 0 {
+			break
+		}
+		m = q
+		places--
+	}
+	return Decimal{mantissa: m, places: places}
+}
+
+// Cmp compares d and o and returns -1, 0 or +1.
+func (d Decimal) Cmp(o Decimal) int {
+	places := max(d.places, o.places)
+	return d.scaled(places).Cmp(o.scaled(places))
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+	return d.m().Sign()
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Float64 returns the nearest float, for display and charts.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.m(), pow10(d.places)).Float64()
+	return f
+}
+
+// Mantissa returns the integer mantissa; d = Mantissa * 10^-Places.
+func (d Decimal) Mantissa() *big.Int {
+	return new(big.Int).Set(d.m())
+}
+
+// String formats d with its own number of places, like "-1234.50".
+func (d Decimal) String() string {
+	s := new(big.Int).Abs(d.m()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.places == 0 {
+		return sign + s
+	}
+	if len(s) <= d.places {
+		s = strings.Repeat("0", d.places-len(s)+1) + s
+	}
+	point := len(s) - d.places
+	return sign + s[:point] + "." + s[point:]
+}
@@ -0,0 +1,93 @@
+// Package docs keeps receipts and other documents attached to
+// transactions with a doc: tag, in a directory under the ledger root.
+package docs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Dir is the documents directory under the ledger root. Doc tags are
+// paths relative to the ledger root, so they start with it.
+const Dir = "docs"
+
+// ErrOutside is returned for doc paths that are not in the documents
+// directory.
+var ErrOutside = errors.New("document is not in the documents directory")
+
+// Name is the doc tag value for src attached to a transaction on date:
+// docs/YEAR/DATE-HASH.EXT, so the same file always gets the same name.
+func Name(src, date string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if len(date) < 4 {
+		return "", fmt.Errorf("invalid date %q", date)
+	}
+	name := date + "-" + hex.EncodeToString(h.Sum(nil))[:12] + strings.ToLower(filepath.Ext(src))
+	return path.Join(Dir, date[:4], name), nil
+}
+
+// Save copies src to name under the ledger root, unless it is already
+// there.
+func Save(root, src, name string) error {
+	dst := filepath.Join(root, filepath.FromSlash(name))
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// copy to a temporary name first, so an interrupted copy doesn't
+	// leave a truncated document behind
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".attach-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Open opens the document a doc tag points to. Only files inside the
+// documents directory can be opened, whatever the tag says.
+func Open(root, name string) (*os.File, error) {
+	name = path.Clean("/" + filepath.ToSlash(name))[1:]
+	rel, ok := strings.CutPrefix(name, Dir+"/")
+	if !ok {
+		return nil, ErrOutside
+	}
+	dir, err := os.OpenRoot(filepath.Join(root, Dir))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	// os.Root also refuses symlinks that lead out of the directory
+	return dir.Open(filepath.FromSlash(rel))
+}
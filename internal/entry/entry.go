@@ -0,0 +1,35 @@
+// Package entry models the journal entries Teka writes and renders them as
+// journal text, so every writer produces the same layout.
+package entry
+
+type LineType int
+
+const (
+	LineTransaction LineType = iota
+	LinePosting
+	LineComment
+)
+
+type Line struct {
+	Type    LineType
+	Date    string // for LineTransaction
+	Status  string // "", "!" (pending) or "*" (cleared), for LineTransaction and LinePosting
+	Code    string // for LineTransaction
+	Payee   string // for LineTransaction, written as "PAYEE | NOTE"
+	Note    string // for LineTransaction
+	Account string // for LinePosting
+	Amount  string // for LinePosting
+	Tags    []Tag  // for LineTransaction and LinePosting, written in the comment
+	Text    string // for LineComment
+	Indent  bool   // true for ';', false for '#'
+}
+
+// Tag is a hledger tag, written as NAME:VALUE in a comment.
+type Tag struct {
+	Name  string
+	Value string
+}
+
+type Transaction struct {
+	Lines []Line
+}
@@ -0,0 +1,206 @@
+package entry
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/azbashar/teka/internal/journal"
+)
+
+// postingIndent is the indentation of posting and indented comment lines.
+const postingIndent = "    "
+
+// Formatter renders transactions as journal text. Amounts are written in
+// their commodity's style from Journal and lined up on the decimal mark,
+// starting no earlier than AmountColumn characters after the indentation.
+type Formatter struct {
+	AmountColumn int
+	// Journal supplies commodity styles. It may be nil, then amounts keep
+	// the style they were typed in.
+	Journal *journal.Journal
+}
+
+// posting is a posting line split into the parts that get aligned.
+type posting struct {
+	account string
+	// before and after the decimal mark; raw amounts that couldn't be
+	// parsed are all in before and are not aligned
+	before, after string
+	raw           bool
+	comment       string
+}
+
+// Format renders the transaction, one line per Line, each ending in a
+// newline.
+func (f Formatter) Format(tx Transaction) string {
+	postings := map[int]posting{}
+	// the column the decimal marks line up at
+	anchor := 0
+	for i, line := range tx.Lines {
+		if line.Type != LinePosting {
+			continue
+		}
+		p := f.posting(line)
+		postings[i] = p
+		if p.before != "" && !p.raw {
+			anchor = max(anchor, f.amountStart(p)+width(p.before))
+		}
+	}
+
+	var b strings.Builder
+	for i, line := range tx.Lines {
+		switch line.Type {
+		case LineComment:
+			if line.Indent {
+				b.WriteString(postingIndent)
+			}
+			b.WriteString(line.Text)
+		case LineTransaction:
+			b.WriteString(header(line))
+		case LinePosting:
+			p := postings[i]
+			b.WriteString(postingIndent + p.account)
+			if p.before != "" || p.after != "" {
+				start := f.amountStart(p)
+				if !p.raw {
+					start = anchor - width(p.before)
+				}
+				b.WriteString(strings.Repeat(" ", start-len(postingIndent)-width(p.account)))
+				b.WriteString(p.before + p.after)
+			}
+			if comment := withTags(p.comment, line.Tags); comment != "" {
+				b.WriteString("  ; " + comment)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// amountStart is the earliest column a posting's amount can start at: the
+// configured column, or two spaces after a long account name.
+func (f Formatter) amountStart(p posting) int {
+	return len(postingIndent) + max(f.AmountColumn+1, width(p.account)+2)
+}
+
+func (f Formatter) posting(line Line) posting {
+	p := posting{account: normalizeStatus(line.Status + strings.TrimSpace(line.Account))}
+	text, comment, _ := strings.Cut(line.Amount, ";")
+	p.comment = strings.TrimSpace(comment)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return p
+	}
+
+	amount, assertion, err := f.Journal.ParsePostingAmount(text)
+	if err != nil || amount == nil {
+		p.before, p.raw = text, true
+		return p
+	}
+	p.before, p.after = f.amount(*amount)
+	if assertion != nil {
+		op := " ="
+		if assertion.Total {
+			op += "="
+		}
+		if assertion.Inclusive {
+			op += "*"
+		}
+		before, after := f.amount(assertion.Amount)
+		p.after += op + " " + before + after
+	}
+	return p
+}
+
+// amount formats an amount and its cost in their commodity styles, split
+// at the decimal mark.
+func (f Formatter) amount(a journal.Amount) (string, string) {
+	cost := a.Cost
+	a.Cost = nil
+	before, after := a.FormatAligned(f.style(a))
+	if cost != nil {
+		op := " @ "
+		if cost.Total {
+			op = " @@ "
+		}
+		after += op + cost.Amount.Format(f.style(cost.Amount))
+	}
+	return before, after
+}
+
+// style is the journal's style for the amount's commodity, with enough
+// precision to keep every digit that was typed.
+func (f Formatter) style(a journal.Amount) journal.Style {
+	style := a.Style
+	if f.Journal != nil {
+		if known, ok := f.Journal.Styles[a.Commodity]; ok {
+			style = known
+		}
+	}
+	style.Precision = max(style.Precision, a.Quantity.Places())
+	return style
+}
+
+// header writes "DATE [STATUS] [(CODE)] [PAYEE | ]NOTE" and the comment
+// with the tags. Status and code may also be typed at the start of the
+// note.
+func header(line Line) string {
+	status, rest := line.Status, strings.TrimSpace(line.Note)
+	if status == "" {
+		status, rest = splitStatus(rest)
+	}
+	code := ""
+	if line.Code != "" {
+		code = "(" + line.Code + ")"
+	} else if strings.HasPrefix(rest, "(") {
+		if end := strings.Index(rest, ")"); end > 0 {
+			code, rest = rest[:end+1], strings.TrimSpace(rest[end+1:])
+		}
+	}
+	if line.Payee != "" {
+		rest = strings.TrimSpace(line.Payee + " | " + rest)
+	}
+	if len(line.Tags) > 0 {
+		description, comment, _ := strings.Cut(rest, ";")
+		rest = strings.TrimSpace(description) + "  ; " + withTags(strings.TrimSpace(comment), line.Tags)
+	}
+
+	parts := []string{line.Date}
+	for _, part := range []string{status, code, rest} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// withTags adds tags after a comment.
+func withTags(comment string, tags []Tag) string {
+	if len(tags) == 0 {
+		return comment
+	}
+	if comment == "" {
+		return tagText(tags)
+	}
+	return comment + ", " + tagText(tags)
+}
+
+// normalizeStatus writes a posting's status mark with one space after it.
+func normalizeStatus(account string) string {
+	status, rest := splitStatus(account)
+	if status == "" {
+		return rest
+	}
+	return status + " " + rest
+}
+
+func splitStatus(s string) (string, string) {
+	if strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!") {
+		return s[:1], strings.TrimSpace(s[1:])
+	}
+	return "", s
+}
+
+func width(s string) int {
+	return utf8.RuneCountInString(s)
+}
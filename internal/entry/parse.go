@@ -0,0 +1,60 @@
+package entry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parse reads a single journal entry, such as one typed or piped into
+// teka add: optional comment lines, a "DATE NOTE" header, then indented
+// postings and comments. Accounts end at two spaces or a tab, like in
+// hledger.
+func Parse(text string) (Transaction, error) {
+	var tx Transaction
+	header := false
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(raw) == "" {
+			if header {
+				// an entry ends at the first blank line
+				break
+			}
+			continue
+		}
+		indented := raw[0] == ' ' || raw[0] == '\t'
+		line := strings.TrimSpace(raw)
+		switch {
+		case strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+			tx.Lines = append(tx.Lines, Line{Type: LineComment, Text: line, Indent: indented && header})
+		case !indented:
+			if header {
+				return tx, fmt.Errorf("line %d: only one transaction can be added at a time", i+1)
+			}
+			date, note, _ := strings.Cut(line, " ")
+			tx.Lines = append(tx.Lines, ParseHeader(date, note))
+			header = true
+		case !header:
+			return tx, fmt.Errorf("line %d: posting before the transaction date", i+1)
+		default:
+			account, amount := SplitPosting(line)
+			tx.Lines = append(tx.Lines, ParsePosting(account, amount))
+		}
+	}
+	if !header {
+		return tx, errors.New("no transaction found")
+	}
+	return tx, nil
+}
+
+// SplitPosting splits a posting line at the two spaces or tab that end its
+// account name.
+func SplitPosting(line string) (string, string) {
+	end := strings.Index(line, "  ")
+	if tab := strings.Index(line, "\t"); tab >= 0 && (end < 0 || tab < end) {
+		end = tab
+	}
+	if end < 0 {
+		return strings.TrimSpace(line), ""
+	}
+	return strings.TrimSpace(line[:end]), strings.TrimSpace(line[end:])
+}
@@ -0,0 +1,137 @@
+package entry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagShortcut is a +NAME or +NAME:VALUE typed at a prompt.
+var tagShortcut = regexp.MustCompile(`(^|\s)\+(\pL[^\s:,;]*)(?::([^\s,;]*))?`)
+
+// ParseHeader reads a transaction line from the description typed at the
+// note prompt: "[STATUS] [(CODE)] [PAYEE |] NOTE [; COMMENT]", where
+// +NAME:VALUE words before the comment become tags.
+func ParseHeader(date, text string) Line {
+	line := Line{Type: LineTransaction, Date: date}
+	text, line.Tags = cutTags(text)
+	line.Status, text = splitStatus(strings.TrimSpace(text))
+	if strings.HasPrefix(text, "(") {
+		if end := strings.Index(text, ")"); end > 0 {
+			line.Code, text = text[1:end], strings.TrimSpace(text[end+1:])
+		}
+	}
+	description, _, _ := strings.Cut(text, ";")
+	if i := strings.Index(description, "|"); i >= 0 {
+		line.Payee, text = strings.TrimSpace(text[:i]), text[i+1:]
+	}
+	line.Note = strings.TrimSpace(text)
+	return line
+}
+
+// ParsePosting reads a posting line from the account and amount prompts:
+// the account may start with a status mark, the amount may have
+// +NAME:VALUE tags before its comment.
+func ParsePosting(account, amount string) Line {
+	line := Line{Type: LinePosting}
+	line.Status, line.Account = splitStatus(strings.TrimSpace(account))
+	amount, line.Tags = cutTags(amount)
+	line.Amount = strings.TrimSpace(amount)
+	return line
+}
+
+// ParseStatus accepts a status mark or its name: cleared, pending or
+// unmarked.
+func ParseStatus(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "unmarked":
+		return "", nil
+	case "!", "pending":
+		return "!", nil
+	case "*", "cleared":
+		return "*", nil
+	}
+	return "", fmt.Errorf("invalid status %q, use cleared, pending or unmarked", s)
+}
+
+// Description is "PAYEE | NOTE", or the note without a payee, without
+// the comment.
+func (l Line) Description() string {
+	note, _, _ := strings.Cut(l.Note, ";")
+	note = strings.TrimSpace(note)
+	if l.Payee == "" {
+		return note
+	}
+	return strings.TrimSpace(l.Payee + " | " + note)
+}
+
+// TypedNote is the note prompt answer ParseHeader reads the line from.
+func (l Line) TypedNote() string {
+	var parts []string
+	if l.Status != "" {
+		parts = append(parts, l.Status)
+	}
+	if l.Code != "" {
+		parts = append(parts, "("+l.Code+")")
+	}
+	parts = append(parts, l.Description())
+	parts = append(parts, tagShortcuts(l.Tags)...)
+	if _, comment, ok := strings.Cut(l.Note, ";"); ok {
+		parts = append(parts, ";", strings.TrimSpace(comment))
+	}
+	return strings.Join(parts, " ")
+}
+
+// TypedPosting is the account and amount prompt answers ParsePosting reads
+// the line from.
+func (l Line) TypedPosting() (string, string) {
+	account := l.Account
+	if l.Status != "" {
+		account = l.Status + " " + account
+	}
+	amount, comment, hasComment := strings.Cut(l.Amount, ";")
+	parts := append([]string{strings.TrimSpace(amount)}, tagShortcuts(l.Tags)...)
+	if hasComment {
+		parts = append(parts, ";", strings.TrimSpace(comment))
+	}
+	return account, strings.TrimSpace(strings.Join(parts, " "))
+}
+
+func tagShortcuts(tags []Tag) []string {
+	var out []string
+	for _, t := range tags {
+		if t.Value == "" {
+			out = append(out, "+"+t.Name)
+		} else {
+			out = append(out, "+"+t.Name+":"+t.Value)
+		}
+	}
+	return out
+}
+
+// cutTags takes the tag shortcuts out of the text before its comment.
+func cutTags(text string) (string, []Tag) {
+	before, comment, hasComment := strings.Cut(text, ";")
+	matches := tagShortcut.FindAllStringSubmatch(before, -1)
+	if matches == nil {
+		return text, nil
+	}
+	var tags []Tag
+	for _, m := range matches {
+		tags = append(tags, Tag{Name: m[2], Value: m[3]})
+	}
+	before = strings.Join(strings.Fields(tagShortcut.ReplaceAllString(before, "$1")), " ")
+	if hasComment {
+		return before + " ;" + comment, tags
+	}
+	return before, tags
+}
+
+// tagText writes tags the way hledger reads them from a comment.
+func tagText(tags []Tag) string {
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Name + ":" + t.Value
+	}
+	return strings.Join(parts, ", ")
+}
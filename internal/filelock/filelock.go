@@ -0,0 +1,16 @@
+// Package filelock takes advisory locks on whole files, so Teka processes
+// writing the same journal take turns.
+package filelock
+
+import "os"
+
+// Lock blocks until it holds an exclusive lock on f. The lock is released
+// by Unlock or when f is closed.
+func Lock(f *os.File) error {
+	return lock(f)
+}
+
+// Unlock releases the lock taken with Lock.
+func Unlock(f *os.File) error {
+	return unlock(f)
+}
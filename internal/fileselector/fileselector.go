@@ -38,6 +38,19 @@ func GetMainFile(file, mainFile string) (string, error) {
 	return filepath.Join(GetRootDir(), "main.journal"), nil
 }
 
+// GetLedgerRoot is the directory documents are kept under: the files root
+// with the efficient file structure, otherwise the main file's directory.
+func GetLedgerRoot(file, mainFile string) (string, error) {
+	if config.Cfg.EfficientFileStructure.Enabled {
+		return ExpandHome(GetRootDir()), nil
+	}
+	main, err := GetMainFile(file, mainFile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(main), nil
+}
+
 func GetRequiredFiles(start, end, file string) ([]string, string, error) {
 	if file != "" {
 		return []string{file}, "", nil
@@ -0,0 +1,129 @@
+package fileselector
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/azbashar/teka/internal/config"
+)
+
+// readerPrefixes are the "FORMAT:" prefixes hledger accepts in front of a
+// file path.
+var readerPrefixes = []string{"journal:", "timeclock:", "timedot:", "csv:", "ssv:", "tsv:", "rules:"}
+
+// ExpandHome replaces a leading ~ with the user's home directory.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// WithIncludes returns files together with every file they include,
+// directly or through other includes. Files that can't be read are still
+// returned so callers notice when they appear.
+func WithIncludes(files []string) []string {
+	seen := map[string]bool{}
+	var result []string
+
+	var walk func(path string)
+	walk = func(path string) {
+		path = filepath.Clean(ExpandHome(path))
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		result = append(result, path)
+
+		for _, inc := range Includes(path) {
+			walk(inc)
+		}
+	}
+
+	for _, f := range files {
+		for _, prefix := range readerPrefixes {
+			f = strings.TrimPrefix(f, prefix)
+		}
+		walk(f)
+	}
+	return result
+}
+
+// Includes returns the files named by the include directives of a journal.
+// Paths are resolved relative to the journal and globs are expanded.
+func Includes(journal string) []string {
+	f, err := os.Open(journal)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var includes []string
+	dir := filepath.Dir(journal)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "include ") && !strings.HasPrefix(line, "!include ") {
+			continue
+		}
+		_, arg, _ := strings.Cut(line, " ")
+		// drop trailing comments
+		if i := strings.Index(arg, " ;"); i >= 0 {
+			arg = arg[:i]
+		}
+		arg = strings.TrimSpace(arg)
+		for _, prefix := range readerPrefixes {
+			arg = strings.TrimPrefix(arg, prefix)
+		}
+		if arg == "" {
+			continue
+		}
+
+		arg = ExpandHome(arg)
+		if !filepath.IsAbs(arg) {
+			arg = filepath.Join(dir, arg)
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			includes = append(includes, arg)
+			continue
+		}
+		includes = append(includes, matches...)
+	}
+	return includes
+}
+
+// GetJournalRoots returns the journals teka reads from: the given file and
+// main file, LEDGER_FILE, or every journal under the files root. Files they
+// include are not part of the result, see WithIncludes.
+func GetJournalRoots(file, mainFile string) []string {
+	var roots []string
+	switch {
+	case file != "" || mainFile != "":
+		for _, f := range []string{mainFile, file} {
+			if f != "" {
+				roots = append(roots, f)
+			}
+		}
+	case !config.Cfg.EfficientFileStructure.Enabled:
+		if f := os.Getenv("LEDGER_FILE"); f != "" {
+			roots = append(roots, f)
+		}
+	default:
+		root := ExpandHome(GetRootDir())
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && filepath.Ext(path) == ".journal" {
+				roots = append(roots, path)
+			}
+			return nil
+		})
+	}
+	return roots
+}
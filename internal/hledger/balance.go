@@ -0,0 +1,76 @@
+package hledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// BalanceRow is one account of a single-period balance report. hledger
+// encodes it as a [fullName, displayName, indent, amount] array. In tree
+// mode Amount is the balance including subaccounts.
+type BalanceRow struct {
+	Account     string
+	DisplayName string
+	Indent      int
+	Amount      MixedAmount
+}
+
+func (b *BalanceRow) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 4 {
+		return fmt.Errorf("balance row should have 4 elements, got %d", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &b.Account); err != nil {
+		return fmt.Errorf("balance row account: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &b.DisplayName); err != nil {
+		return fmt.Errorf("balance row %q: %w", b.Account, err)
+	}
+	if err := json.Unmarshal(parts[2], &b.Indent); err != nil {
+		return fmt.Errorf("balance row %q: %w", b.Account, err)
+	}
+	if err := json.Unmarshal(parts[3], &b.Amount); err != nil {
+		return fmt.Errorf("balance row %q: %w", b.Account, err)
+	}
+	return nil
+}
+
+// BalanceReport is the output of a single-period `hledger bal -O json`.
+type BalanceReport struct {
+	Rows  []BalanceRow
+	Total MixedAmount
+}
+
+// Row returns the row of the given account.
+func (b BalanceReport) Row(account string) (BalanceRow, bool) {
+	for _, r := range b.Rows {
+		if r.Account == account {
+			return r, true
+		}
+	}
+	return BalanceRow{}, false
+}
+
+// DecodeBalanceReport decodes the output of `hledger bal -O json` without
+// a report interval.
+func DecodeBalanceReport(data []byte) (*BalanceReport, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, &DecodeError{Report: "balance report", Err: err}
+	}
+	if len(parts) != 2 {
+		return nil, &DecodeError{Report: "balance report", Err: errors.New("expected rows and total")}
+	}
+	var report BalanceReport
+	if err := json.Unmarshal(parts[0], &report.Rows); err != nil {
+		return nil, &DecodeError{Report: "balance report", Err: err}
+	}
+	if err := json.Unmarshal(parts[1], &report.Total); err != nil {
+		return nil, &DecodeError{Report: "balance report", Err: err}
+	}
+	return &report, nil
+}
@@ -0,0 +1,121 @@
+package hledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DecodeError is returned when hledger's output can't be read into the
+// typed model. Report names the kind of output that was expected.
+type DecodeError struct {
+	Report string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to parse hledger %s output: %v", e.Report, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeCompoundReport decodes the output of `hledger bs/is -O json`.
+func DecodeCompoundReport(data []byte) (*CompoundReport, error) {
+	var raw struct {
+		CompoundReport
+		Dates      *[]DateSpan  `json:"cbrDates"`
+		Subreports *[]Subreport `json:"cbrSubreports"`
+		Totals     *ReportRow   `json:"cbrTotals"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, &DecodeError{Report: "compound balance report", Err: err}
+	}
+	switch {
+	case raw.Dates == nil:
+		return nil, &DecodeError{Report: "compound balance report", Err: errors.New("missing cbrDates")}
+	case raw.Subreports == nil:
+		return nil, &DecodeError{Report: "compound balance report", Err: errors.New("missing cbrSubreports")}
+	case raw.Totals == nil:
+		return nil, &DecodeError{Report: "compound balance report", Err: errors.New("missing cbrTotals")}
+	}
+	report := raw.CompoundReport
+	report.Dates = *raw.Dates
+	report.Subreports = *raw.Subreports
+	report.Totals = *raw.Totals
+	return &report, nil
+}
+
+// DecodeTransactions decodes the output of `hledger print -O json`.
+func DecodeTransactions(data []byte) ([]Transaction, error) {
+	var raw []struct {
+		Transaction
+		Index *int    `json:"tindex"`
+		Date  *string `json:"tdate"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, &DecodeError{Report: "print", Err: err}
+	}
+	txs := make([]Transaction, 0, len(raw))
+	for i, r := range raw {
+		if r.Index == nil {
+			return nil, &DecodeError{Report: "print", Err: fmt.Errorf("transaction %d: missing tindex", i)}
+		}
+		if r.Date == nil {
+			return nil, &DecodeError{Report: "print", Err: fmt.Errorf("transaction %d: missing tdate", i)}
+		}
+		tx := r.Transaction
+		tx.Index = *r.Index
+		tx.Date = *r.Date
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// Error is a failed hledger invocation. When hledger points at a location
+// in a journal, File, Line and Column are filled in.
+type Error struct {
+	Args    []string
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("hledger error: %v", e.Err)
+	}
+	return fmt.Sprintf("hledger error: %v: %s", e.Err, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// hledger reports parse errors as "FILE:LINE[:COL[-COL]]:" on the first line.
+var errorPos = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?(?:-\d+)?:`)
+
+// NewError builds an Error from the output hledger printed before exiting
+// with err.
+func NewError(args []string, output []byte, err error) *Error {
+	msg := strings.TrimSpace(string(output))
+	e := &Error{Args: args, Message: msg, Err: err}
+
+	first, _, _ := strings.Cut(msg, "\n")
+	first = strings.TrimPrefix(first, "hledger: ")
+	first = strings.TrimPrefix(first, "Error: ")
+	if m := errorPos.FindStringSubmatch(first); m != nil {
+		e.File = m[1]
+		e.Line, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			e.Column, _ = strconv.Atoi(m[3])
+		}
+	}
+	return e
+}
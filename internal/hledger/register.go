@@ -0,0 +1,49 @@
+package hledger
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RegisterRow is one posting of `hledger register -O json`. hledger
+// encodes it as a [date, period, description, posting, total] array, where
+// the date and description are only given for the first posting of a
+// transaction. Total is the running total up to and including Posting.
+type RegisterRow struct {
+	Date        *string
+	Description *string
+	Posting     Posting
+	Total       MixedAmount
+}
+
+func (r *RegisterRow) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 5 {
+		return fmt.Errorf("register row should have 5 elements, got %d", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &r.Date); err != nil {
+		return fmt.Errorf("register row date: %w", err)
+	}
+	if err := json.Unmarshal(parts[2], &r.Description); err != nil {
+		return fmt.Errorf("register row description: %w", err)
+	}
+	if err := json.Unmarshal(parts[3], &r.Posting); err != nil {
+		return fmt.Errorf("register row posting: %w", err)
+	}
+	if err := json.Unmarshal(parts[4], &r.Total); err != nil {
+		return fmt.Errorf("register row total: %w", err)
+	}
+	return nil
+}
+
+// DecodeRegister decodes the output of `hledger register -O json`.
+func DecodeRegister(data []byte) ([]RegisterRow, error) {
+	var rows []RegisterRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, &DecodeError{Report: "register", Err: err}
+	}
+	return rows, nil
+}
@@ -0,0 +1,79 @@
+package hledger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Runner runs hledger with the given arguments and returns what it printed
+// on stdout and stderr separately. A failed run returns an *Error.
+type Runner interface {
+	Run(ctx context.Context, args []string) (stdout, stderr []byte, err error)
+}
+
+const (
+	DefaultTimeout      = 60 * time.Second
+	DefaultMaxProcesses = 4
+)
+
+// ErrTimeout is wrapped by the error of a run that took longer than the
+// runner's timeout.
+var ErrTimeout = errors.New("hledger timed out")
+
+// ExecRunner runs the hledger binary. At most MaxProcesses runs are active
+// at once, the rest wait for a free slot or for their context to end.
+type ExecRunner struct {
+	path    string
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+// NewExecRunner returns a runner for the hledger binary at path. Zero values
+// fall back to "hledger" on PATH, DefaultTimeout and DefaultMaxProcesses.
+func NewExecRunner(path string, timeout time.Duration, maxProcesses int) *ExecRunner {
+	if path == "" {
+		path = "hledger"
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if maxProcesses <= 0 {
+		maxProcesses = DefaultMaxProcesses
+	}
+	return &ExecRunner{
+		path:    path,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxProcesses),
+	}
+}
+
+func (r *ExecRunner) Run(ctx context.Context, args []string) ([]byte, []byte, error) {
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return nil, nil, &Error{Args: args, Err: ctx.Err()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s", ErrTimeout, r.timeout)
+		} else if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return stdout.Bytes(), stderr.Bytes(), NewError(args, stderr.Bytes(), err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
@@ -0,0 +1,272 @@
+// Package hledger contains typed models for the JSON hledger prints with
+// `-O json` and the helpers to decode it. Every report handler goes through
+// this package so that a change in hledger's output breaks in one place.
+package hledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/azbashar/teka/internal/decimal"
+)
+
+// Quantity is hledger's decimal number. DecimalMantissa and DecimalPlaces
+// give the exact value, FloatingPoint is an approximation for display.
+type Quantity struct {
+	DecimalMantissa int64   `json:"decimalMantissa"`
+	DecimalPlaces   int     `json:"decimalPlaces"`
+	FloatingPoint   float64 `json:"floatingPoint"`
+}
+
+// String formats the exact decimal value, for example "-1234.50".
+func (q Quantity) String() string {
+	mantissa := q.DecimalMantissa
+	sign := ""
+	if mantissa < 0 {
+		sign = "-"
+		mantissa = -mantissa
+	}
+	digits := strconv.FormatInt(mantissa, 10)
+	if q.DecimalPlaces <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= q.DecimalPlaces {
+		digits = strings.Repeat("0", q.DecimalPlaces-len(digits)+1) + digits
+	}
+	point := len(digits) - q.DecimalPlaces
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Decimal returns the exact value.
+func (q Quantity) Decimal() decimal.Decimal {
+	return decimal.New(q.DecimalMantissa, q.DecimalPlaces)
+}
+
+// AmountStyle describes how a commodity is displayed.
+type AmountStyle struct {
+	CommoditySide   string `json:"ascommodityside"` // "L" or "R"
+	CommoditySpaced bool   `json:"ascommodityspaced"`
+	DecimalMark     string `json:"asdecimalmark"`
+	Precision       any    `json:"asprecision"` // a number or "NaturalPrecision"
+}
+
+// Amount is a single commodity amount, optionally with a cost.
+type Amount struct {
+	Commodity string       `json:"acommodity"`
+	Quantity  Quantity     `json:"aquantity"`
+	Cost      *Cost        `json:"acost"`
+	Style     *AmountStyle `json:"astyle"`
+}
+
+// String formats the amount with its commodity on the side its style asks
+// for, without digit grouping, for example "$-5.00" or "-5.00 EUR".
+func (a Amount) String() string {
+	if a.Commodity == "" {
+		return a.Quantity.String()
+	}
+	if a.Style != nil && a.Style.CommoditySide == "L" {
+		if a.Style.CommoditySpaced {
+			return a.Commodity + " " + a.Quantity.String()
+		}
+		return a.Commodity + a.Quantity.String()
+	}
+	return a.Quantity.String() + " " + a.Commodity
+}
+
+// Cost is the @ (unit) or @@ (total) cost attached to an amount.
+type Cost struct {
+	Tag    string `json:"tag"` // "UnitCost" or "TotalCost"
+	Amount Amount `json:"contents"`
+}
+
+// IsTotal reports whether the cost was written with @@.
+func (c Cost) IsTotal() bool {
+	return c.Tag == "TotalCost"
+}
+
+// MixedAmount is a sum of amounts in one or more commodities.
+type MixedAmount []Amount
+
+// String formats every commodity of the amount, separated by commas.
+func (m MixedAmount) String() string {
+	if len(m) == 0 {
+		return "0"
+	}
+	parts := make([]string, len(m))
+	for i, a := range m {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// First returns the first amount, or a zero amount when empty.
+func (m MixedAmount) First() Amount {
+	if len(m) == 0 {
+		return Amount{}
+	}
+	return m[0]
+}
+
+// Tag is a key/value tag. hledger encodes it as a two element array.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var pair []string
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("tag should have 2 elements, got %d", len(pair))
+	}
+	t.Key, t.Value = pair[0], pair[1]
+	return nil
+}
+
+// SourcePos is a position in a journal file.
+type SourcePos struct {
+	File   string `json:"sourceName"`
+	Line   int    `json:"sourceLine"`
+	Column int    `json:"sourceColumn"`
+}
+
+// Posting is one line of a transaction.
+type Posting struct {
+	Account string      `json:"paccount"`
+	Amount  MixedAmount `json:"pamount"`
+	Comment string      `json:"pcomment"`
+	Status  string      `json:"pstatus"` // Unmarked, Pending or Cleared
+	Tags    []Tag       `json:"ptags"`
+	Type    string      `json:"ptype"`
+	Date    *string     `json:"pdate"`
+	Date2   *string     `json:"pdate2"`
+	// TransactionIndex is the tindex of the parent transaction, as a string.
+	TransactionIndex string `json:"ptransaction_"`
+}
+
+// Transaction is a journal entry as printed by `hledger print -O json`.
+type Transaction struct {
+	Index            int         `json:"tindex"`
+	Date             string      `json:"tdate"`
+	Date2            *string     `json:"tdate2"`
+	Description      string      `json:"tdescription"`
+	Code             string      `json:"tcode"`
+	Comment          string      `json:"tcomment"`
+	PrecedingComment string      `json:"tprecedingcomment"`
+	Status           string      `json:"tstatus"`
+	Tags             []Tag       `json:"ttags"`
+	Postings         []Posting   `json:"tpostings"`
+	SourcePos        []SourcePos `json:"tsourcepos"`
+}
+
+// Tag returns the value of the first tag named key.
+func (t Transaction) Tag(key string) (string, bool) {
+	for _, tag := range t.Tags {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// DateSpan is a report period. Open ends are left empty.
+type DateSpan struct {
+	Start string
+	End   string
+}
+
+func (d *DateSpan) UnmarshalJSON(data []byte) error {
+	var ends []*struct {
+		Tag      string `json:"tag"`
+		Contents string `json:"contents"`
+	}
+	if err := json.Unmarshal(data, &ends); err != nil {
+		return err
+	}
+	if len(ends) != 2 {
+		return fmt.Errorf("date span should have 2 elements, got %d", len(ends))
+	}
+	if ends[0] != nil {
+		d.Start = ends[0].Contents
+	}
+	if ends[1] != nil {
+		d.End = ends[1].Contents
+	}
+	return nil
+}
+
+// ReportRow is one account row of a periodic report. Amounts has one entry
+// per report period.
+type ReportRow struct {
+	Name    string        `json:"prrName"`
+	Amounts []MixedAmount `json:"prrAmounts"`
+	Total   MixedAmount   `json:"prrTotal"`
+	Average MixedAmount   `json:"prrAverage"`
+}
+
+// Period returns the amounts of period i, or nil when out of range.
+func (r ReportRow) Period(i int) MixedAmount {
+	if i < 0 || i >= len(r.Amounts) {
+		return nil
+	}
+	return r.Amounts[i]
+}
+
+// PeriodicReport is a multi-period balance report.
+type PeriodicReport struct {
+	Dates  []DateSpan  `json:"prDates"`
+	Rows   []ReportRow `json:"prRows"`
+	Totals ReportRow   `json:"prTotals"`
+}
+
+// Subreport is one section (Assets, Liabilities, ...) of a compound report.
+// hledger encodes it as a [name, report, increasesTotal] array.
+type Subreport struct {
+	Name           string
+	Report         PeriodicReport
+	IncreasesTotal bool
+}
+
+func (s *Subreport) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) < 2 {
+		return fmt.Errorf("subreport should have at least 2 elements, got %d", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &s.Name); err != nil {
+		return fmt.Errorf("subreport name: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &s.Report); err != nil {
+		return fmt.Errorf("subreport %q: %w", s.Name, err)
+	}
+	if len(parts) > 2 {
+		if err := json.Unmarshal(parts[2], &s.IncreasesTotal); err != nil {
+			return fmt.Errorf("subreport %q: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// CompoundReport is the output of bs, is, cf and friends.
+type CompoundReport struct {
+	Title      string      `json:"cbrTitle"`
+	Dates      []DateSpan  `json:"cbrDates"`
+	Subreports []Subreport `json:"cbrSubreports"`
+	Totals     ReportRow   `json:"cbrTotals"`
+}
+
+// Subreport returns the section with the given name, ignoring case.
+func (c CompoundReport) Subreport(name string) (Subreport, bool) {
+	for _, s := range c.Subreports {
+		if strings.EqualFold(s.Name, name) {
+			return s, true
+		}
+	}
+	return Subreport{}, false
+}
@@ -0,0 +1,361 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/azbashar/teka/internal/decimal"
+)
+
+// amountContext is what the parser knows when reading an amount: the
+// journal's decimal-mark directive, declared commodity styles and the D
+// default commodity.
+type amountContext struct {
+	decimalMark      byte
+	commodities      map[string]Style
+	defaultCommodity *Amount
+}
+
+// ParseAmount reads a single amount like "$-1,000.50", "-1000.50 USD" or
+// "EUR 10 @ 1.1 USD". When both '.' and ',' appear, the last one is the
+// decimal mark; a single one is taken as the decimal mark, like hledger
+// does for commodities without a declared style.
+func ParseAmount(s string) (Amount, error) {
+	return amountContext{}.parseAmount(s)
+}
+
+// ParseAmount reads a single amount using the journal's commodity
+// declarations to pick the decimal mark. A nil journal declares nothing.
+func (j *Journal) ParseAmount(s string) (Amount, error) {
+	ctx := amountContext{}
+	if j != nil {
+		ctx.commodities = j.Commodities
+	}
+	return ctx.parseAmount(s)
+}
+
+// ParsePostingAmount reads the amount part of a posting:
+// "AMOUNT [@ COST | @@ COST] [= ASSERTION]". Either part may be missing,
+// in which case its result is nil.
+func (j *Journal) ParsePostingAmount(s string) (*Amount, *Assertion, error) {
+	ctx := amountContext{}
+	if j != nil {
+		ctx.commodities = j.Commodities
+	}
+	return ctx.parsePostingAmount(s)
+}
+
+func (ctx amountContext) parsePostingAmount(s string) (*Amount, *Assertion, error) {
+	var assertion *Assertion
+	if i := indexOutsideQuotes(s, '='); i >= 0 {
+		rest := s[i+1:]
+		assertion = &Assertion{}
+		if strings.HasPrefix(rest, "=") {
+			assertion.Total = true
+			rest = rest[1:]
+		}
+		if strings.HasPrefix(rest, "*") {
+			assertion.Inclusive = true
+			rest = rest[1:]
+		}
+		a, err := ctx.parseAmount(rest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("balance assertion: %w", err)
+		}
+		assertion.Amount = a
+		s = s[:i]
+	}
+	if strings.TrimSpace(s) == "" {
+		return nil, assertion, nil
+	}
+	a, err := ctx.parseAmount(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &a, assertion, nil
+}
+
+func (ctx amountContext) parseAmount(s string) (Amount, error) {
+	main, cost, hasCost := strings.Cut(s, "@")
+	a, err := ctx.parseSimpleAmount(main)
+	if err != nil {
+		return Amount{}, err
+	}
+	if hasCost {
+		total := strings.HasPrefix(cost, "@")
+		c, err := ctx.parseSimpleAmount(strings.TrimPrefix(cost, "@"))
+		if err != nil {
+			return Amount{}, fmt.Errorf("cost: %w", err)
+		}
+		a.Cost = &Cost{Total: total, Amount: c}
+	}
+	return a, nil
+}
+
+// parseSimpleAmount reads an amount without cost or assertion.
+func (ctx amountContext) parseSimpleAmount(s string) (Amount, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Amount{}, errors.New("empty amount")
+	}
+
+	neg := false
+	readSign := func() {
+		if strings.HasPrefix(s, "-") {
+			neg = !neg
+			s = strings.TrimSpace(s[1:])
+		} else if strings.HasPrefix(s, "+") {
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+
+	var style Style
+	readSign()
+	commodity, rest, err := readCommodity(s)
+	if err != nil {
+		return Amount{}, err
+	}
+	if commodity != "" {
+		style.Side = 'L'
+		style.Spaced = strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\t")
+		s = strings.TrimSpace(rest)
+		readSign()
+	}
+
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == ',')
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	number := s[:end]
+	s = s[end:]
+	if number == "" {
+		return Amount{}, fmt.Errorf("no number in amount %q", strings.TrimSpace(orig))
+	}
+
+	if commodity == "" {
+		style.Spaced = strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t")
+		s = strings.TrimSpace(s)
+		if s != "" {
+			commodity, s, err = readCommodity(s)
+			if err != nil {
+				return Amount{}, err
+			}
+			style.Side = 'R'
+		}
+	}
+	if strings.TrimSpace(s) != "" {
+		return Amount{}, fmt.Errorf("unexpected %q in amount %q", strings.TrimSpace(s), strings.TrimSpace(orig))
+	}
+
+	if commodity == "" && ctx.defaultCommodity != nil {
+		commodity = ctx.defaultCommodity.Commodity
+		side, spaced := ctx.defaultCommodity.Style.Side, ctx.defaultCommodity.Style.Spaced
+		style.Side, style.Spaced = side, spaced
+	}
+	if style.Side == 0 {
+		style.Side = 'R'
+	}
+
+	mark := ctx.decimalMark
+	if declared, ok := ctx.commodities[commodity]; ok && declared.DecimalMark != 0 {
+		mark = declared.DecimalMark
+	}
+	q, decMark, groupMark, err := parseNumber(number, mark)
+	if err != nil {
+		return Amount{}, err
+	}
+	if neg {
+		q = q.Neg()
+	}
+	style.DecimalMark = decMark
+	style.GroupMark = groupMark
+	style.Precision = q.Places()
+
+	return Amount{Quantity: q, Commodity: commodity, Style: style}, nil
+}
+
+// readCommodity reads a quoted or bare commodity symbol at the start of s.
+// It returns "" when s starts with a number.
+func readCommodity(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.Index(s[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted commodity in %q", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune(`-+.,@;"{}=*`, r)
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], s[end:], nil
+}
+
+// parseNumber reads digits with optional decimal and digit group marks.
+// mark is the known decimal mark, or 0 to guess it.
+func parseNumber(s string, mark byte) (decimal.Decimal, byte, byte, error) {
+	dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+	if mark == 0 {
+		switch {
+		case dots > 0 && commas > 0:
+			if strings.LastIndex(s, ".") > strings.LastIndex(s, ",") {
+				mark = '.'
+			} else {
+				mark = ','
+			}
+		case dots == 1 && commas == 0:
+			mark = '.'
+		case commas == 1 && dots == 0:
+			mark = ','
+		default:
+			// no mark, or several of the same kind which must be
+			// digit group marks
+			mark = '.'
+			if dots > 1 {
+				mark = ','
+			}
+		}
+	}
+
+	var group byte
+	other := byte(',')
+	if mark == ',' {
+		other = '.'
+	}
+	if strings.IndexByte(s, other) >= 0 {
+		group = other
+	}
+	if strings.Count(s, string(mark)) > 1 {
+		return decimal.Decimal{}, 0, 0, fmt.Errorf("invalid number %q", s)
+	}
+
+	plain := strings.ReplaceAll(s, string(other), "")
+	if mark == ',' {
+		plain = strings.Replace(plain, ",", ".", 1)
+	}
+	if strings.HasSuffix(plain, ".") {
+		plain = strings.TrimSuffix(plain, ".")
+	}
+	q, err := decimal.Parse(plain)
+	if err != nil {
+		return decimal.Decimal{}, 0, 0, fmt.Errorf("invalid number %q", s)
+	}
+	return q, mark, group, nil
+}
+
+func indexOutsideQuotes(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case c:
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// String writes the amount the way it was read, with its own precision.
+func (a Amount) String() string {
+	style := a.Style
+	style.Precision = a.Quantity.Places()
+	return a.Format(style)
+}
+
+// Format writes the amount in the given style, rounding the quantity to the
+// style's precision. A cost is written in its own style.
+func (a Amount) Format(style Style) string {
+	before, after := a.FormatAligned(style)
+	return before + after
+}
+
+// FormatAligned is Format split at the decimal mark, for lining amounts up
+// in a column. Without decimals the split is at the end of the number.
+func (a Amount) FormatAligned(style Style) (string, string) {
+	number := formatQuantity(a.Quantity.Round(style.Precision).WithPlaces(style.Precision), style)
+	before, after := number, ""
+	if style.Precision > 0 {
+		mark := style.DecimalMark
+		if mark == 0 {
+			mark = '.'
+		}
+		i := strings.LastIndexByte(number, mark)
+		before, after = number[:i], number[i:]
+	}
+	if a.Commodity != "" {
+		commodity := quoteCommodity(a.Commodity)
+		sep := ""
+		if style.Spaced {
+			sep = " "
+		}
+		if style.Side == 'L' {
+			// the sign goes in front of the commodity: -$5.00
+			if strings.HasPrefix(before, "-") {
+				before = "-" + commodity + sep + before[1:]
+			} else {
+				before = commodity + sep + before
+			}
+		} else {
+			after = after + sep + commodity
+		}
+	}
+	if a.Cost != nil {
+		op := " @ "
+		if a.Cost.Total {
+			op = " @@ "
+		}
+		after += op + a.Cost.Amount.String()
+	}
+	return before, after
+}
+
+func formatQuantity(q decimal.Decimal, style Style) string {
+	s := q.String()
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+
+	if style.GroupMark != 0 && len(intPart) > 3 {
+		var b strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteByte(style.GroupMark)
+			}
+			b.WriteRune(c)
+		}
+		intPart = b.String()
+	}
+
+	mark := style.DecimalMark
+	if mark == 0 {
+		mark = '.'
+	}
+	s = intPart
+	if hasFrac {
+		s += string(mark) + frac
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// quoteCommodity quotes commodity symbols that can't be written bare.
+func quoteCommodity(c string) string {
+	if strings.IndexFunc(c, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune(`-+.,@;"{}=*`, r)
+	}) >= 0 {
+		return `"` + c + `"`
+	}
+	return c
+}
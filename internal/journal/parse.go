@@ -0,0 +1,543 @@
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseError is a problem at a position in a journal file.
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads a journal file and the files it includes.
+func Parse(path string) (*Journal, error) {
+	return ParseFiles(path)
+}
+
+// ParseFiles reads several journal files into one journal, like passing
+// -f more than once to hledger. Transactions are balanced and balance
+// assertions checked once everything is read.
+func ParseFiles(paths ...string) (*Journal, error) {
+	p := &parser{
+		j: &Journal{
+			Commodities: map[string]Style{},
+			Styles:      map[string]Style{},
+		},
+		ctx:     amountContext{commodities: map[string]Style{}},
+		reading: map[string]bool{},
+	}
+	p.ctx.commodities = p.j.Commodities
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.parseFile(abs); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.j.finalize(); err != nil {
+		return nil, err
+	}
+	return p.j, nil
+}
+
+type parser struct {
+	j       *Journal
+	ctx     amountContext
+	year    int
+	reading map[string]bool // files being read, to catch include cycles
+}
+
+// block is a directive or transaction with its indented lines.
+type block struct {
+	first int // line number of the first line
+	lines []string
+}
+
+func (p *parser) parseFile(path string) error {
+	if p.reading[path] {
+		return fmt.Errorf("%s includes itself", path)
+	}
+	p.reading[path] = true
+	defer delete(p.reading, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p.j.Files = append(p.j.Files, path)
+
+	// directives like Y and D only apply to the rest of their file
+	saveYear, saveDefault := p.year, p.ctx.defaultCommodity
+	defer func() { p.year, p.ctx.defaultCommodity = saveYear, saveDefault }()
+
+	var cur *block
+	inComment := false
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		b := cur
+		cur = nil
+		return p.parseBlock(path, b)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+
+		if inComment {
+			if strings.TrimSpace(line) == "end comment" {
+				inComment = false
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if cur != nil {
+				cur.lines = append(cur.lines, line)
+			}
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		if strings.ContainsRune(";#*%|", rune(line[0])) {
+			continue
+		}
+		if strings.TrimSpace(line) == "comment" {
+			inComment = true
+			continue
+		}
+		cur = &block{first: lineNo, lines: []string{line}}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func (p *parser) parseBlock(file string, b *block) error {
+	head := b.lines[0]
+	wrap := func(line int, err error) error {
+		var pe *ParseError
+		if errors.As(err, &pe) {
+			return err
+		}
+		return &ParseError{File: file, Line: line, Err: err}
+	}
+
+	switch {
+	case head[0] >= '0' && head[0] <= '9':
+		tx, err := p.parseTransaction(file, b)
+		if err != nil {
+			return err
+		}
+		p.j.Transactions = append(p.j.Transactions, tx)
+		return nil
+	case head[0] == '=' || head[0] == '~':
+		// auto and periodic transactions only matter to hledger's
+		// forecasting and --auto, which the native reports don't do
+		return nil
+	}
+
+	word, rest, _ := strings.Cut(head, " ")
+	rest = strings.TrimSpace(stripComment(rest))
+	switch word {
+	case "include":
+		if err := p.include(file, rest); err != nil {
+			return wrap(b.first, err)
+		}
+	case "account":
+		p.j.Accounts = append(p.j.Accounts, p.parseAccount(file, b))
+	case "commodity":
+		if err := p.parseCommodity(b, rest); err != nil {
+			return wrap(b.first, err)
+		}
+	case "D":
+		a, err := p.ctx.parseSimpleAmount(rest)
+		if err != nil {
+			return wrap(b.first, err)
+		}
+		p.ctx.defaultCommodity = &a
+		p.declare(a.Commodity, a.Style)
+	case "Y", "year":
+		year, err := strconv.Atoi(rest)
+		if err != nil {
+			return wrap(b.first, fmt.Errorf("invalid year %q", rest))
+		}
+		p.year = year
+	case "P":
+		price, err := p.parsePrice(rest)
+		if err != nil {
+			return wrap(b.first, err)
+		}
+		p.j.Prices = append(p.j.Prices, price)
+	case "decimal-mark":
+		if rest != "." && rest != "," {
+			return wrap(b.first, fmt.Errorf("invalid decimal mark %q", rest))
+		}
+		p.ctx.decimalMark = rest[0]
+	}
+	// alias, payee, tag, apply account and friends are accepted and
+	// ignored
+	return nil
+}
+
+func (p *parser) include(file, pattern string) error {
+	// drop a reader prefix like journal:
+	if i := strings.Index(pattern, ":"); i > 1 && !strings.HasPrefix(pattern[i:], `:\`) {
+		pattern = pattern[i+1:]
+	}
+	if strings.HasPrefix(pattern, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		pattern = filepath.Join(home, pattern[1:])
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(file), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no files match include %q", pattern)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if err := p.parseFile(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeCodes are the values a type: tag of an account directive may have.
+var typeCodes = map[string]string{
+	"a": "A", "asset": "A",
+	"l": "L", "liability": "L",
+	"e": "E", "equity": "E",
+	"r": "R", "revenue": "R",
+	"x": "X", "expense": "X",
+	"c": "C", "cash": "C",
+	"v": "V", "conversion": "V",
+}
+
+func (p *parser) parseAccount(file string, b *block) AccountDecl {
+	head := strings.TrimSpace(strings.TrimPrefix(b.lines[0], "account"))
+	name, comment := splitComment(head)
+	decl := AccountDecl{
+		Name:    strings.TrimSpace(name),
+		Comment: comment,
+		Pos:     Pos{File: file, Line: b.first, EndLine: b.first + len(b.lines) - 1},
+	}
+	for _, line := range b.lines[1:] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ";") {
+			decl.Comment = joinComment(decl.Comment, strings.TrimSpace(line[1:]))
+		}
+	}
+	decl.Tags = parseTags(decl.Comment)
+	if t, ok := findTag(decl.Tags, "type"); ok {
+		decl.Type = typeCodes[strings.ToLower(strings.TrimSpace(t))]
+	}
+	return decl
+}
+
+func (p *parser) parseCommodity(b *block, rest string) error {
+	// "commodity 1,000.00 USD" declares the style inline, "commodity USD"
+	// may have a format subdirective
+	quoted := strings.HasPrefix(rest, `"`) && strings.Index(rest[1:], `"`) == len(rest)-2
+	if !quoted && strings.IndexAny(rest, "0123456789") >= 0 {
+		a, err := p.ctx.parseSimpleAmount(rest)
+		if err != nil {
+			return err
+		}
+		p.declare(a.Commodity, a.Style)
+		return nil
+	}
+	symbol := strings.Trim(rest, `"`)
+	for _, line := range b.lines[1:] {
+		line = strings.TrimSpace(stripComment(line))
+		if format, ok := strings.CutPrefix(line, "format "); ok {
+			a, err := p.ctx.parseSimpleAmount(strings.TrimSpace(format))
+			if err != nil {
+				return err
+			}
+			p.declare(symbol, a.Style)
+			return nil
+		}
+	}
+	if _, ok := p.j.Commodities[symbol]; !ok {
+		p.j.Commodities[symbol] = Style{}
+	}
+	return nil
+}
+
+// declare records a commodity style from a directive.
+func (p *parser) declare(commodity string, style Style) {
+	p.j.Commodities[commodity] = style
+	p.j.Styles[commodity] = style
+}
+
+func (p *parser) parsePrice(s string) (Price, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return Price{}, fmt.Errorf("invalid price directive %q", s)
+	}
+	date, _, err := p.parseDate(fields[0])
+	if err != nil {
+		return Price{}, err
+	}
+	rest := fields[1:]
+	// an optional time after the date is ignored
+	if strings.Count(rest[0], ":") >= 1 && len(rest) > 2 && strings.IndexAny(rest[0][:1], "0123456789") == 0 {
+		rest = rest[1:]
+	}
+	commodity := strings.Trim(rest[0], `"`)
+	amount, err := p.ctx.parseSimpleAmount(strings.Join(rest[1:], " "))
+	if err != nil {
+		return Price{}, err
+	}
+	return Price{Date: date, Commodity: commodity, Amount: amount}, nil
+}
+
+var dateRe = regexp.MustCompile(`^(?:(\d{4})[-/.])?(\d{1,2})[-/.](\d{1,2})$`)
+
+// parseDate reads a full or year-less date. The second result is the rest
+// of s after the date.
+func (p *parser) parseDate(s string) (time.Time, string, error) {
+	end := strings.IndexAny(s, " \t=")
+	rest := ""
+	if end >= 0 {
+		s, rest = s[:end], s[end:]
+	}
+	m := dateRe.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, "", fmt.Errorf("invalid date %q", s)
+	}
+	year := p.year
+	if m[1] != "" {
+		year, _ = strconv.Atoi(m[1])
+	} else if year == 0 {
+		year = time.Now().Year()
+	}
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if d.Month() != time.Month(month) || d.Day() != day {
+		return time.Time{}, "", fmt.Errorf("invalid date %q", s)
+	}
+	return d, rest, nil
+}
+
+func (p *parser) parseTransaction(file string, b *block) (Transaction, error) {
+	errAt := func(line int, err error) error {
+		return &ParseError{File: file, Line: line, Err: err}
+	}
+
+	tx := Transaction{
+		Pos: Pos{File: file, Line: b.first, EndLine: b.first + len(b.lines) - 1, Column: 1},
+	}
+	date, head, err := p.parseDate(b.lines[0])
+	if err != nil {
+		return tx, errAt(b.first, err)
+	}
+	tx.Date = date
+	if strings.HasPrefix(head, "=") {
+		date2, rest, err := p.parseDate(head[1:])
+		if err != nil {
+			return tx, errAt(b.first, err)
+		}
+		tx.Date2 = &date2
+		head = rest
+	}
+
+	head, tx.Comment = splitComment(head)
+	head = strings.TrimSpace(head)
+	tx.Status, head = readStatus(head)
+	if strings.HasPrefix(head, "(") {
+		if end := strings.Index(head, ")"); end > 0 {
+			tx.Code = head[1:end]
+			head = strings.TrimSpace(head[end+1:])
+		}
+	}
+	tx.Description = head
+
+	var last *Posting
+	for i, line := range b.lines[1:] {
+		lineNo := b.first + 1 + i
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			text := strings.TrimSpace(trimmed[1:])
+			if last == nil {
+				tx.Comment = joinComment(tx.Comment, text)
+			} else {
+				last.Comment = joinComment(last.Comment, text)
+			}
+			continue
+		}
+		posting, err := p.parsePosting(trimmed)
+		if err != nil {
+			return tx, errAt(lineNo, err)
+		}
+		posting.Pos = Pos{File: file, Line: lineNo, EndLine: lineNo, Column: len(line) - len(strings.TrimLeft(line, " \t")) + 1}
+		tx.Postings = append(tx.Postings, posting)
+		last = &tx.Postings[len(tx.Postings)-1]
+	}
+	for i := range tx.Postings {
+		tx.Postings[i].Tags = parseTags(tx.Postings[i].Comment)
+	}
+	tx.Tags = parseTags(tx.Comment)
+	return tx, nil
+}
+
+func (p *parser) parsePosting(line string) (Posting, error) {
+	var posting Posting
+	line, posting.Comment = splitComment(line)
+	posting.Status, line = readStatus(strings.TrimSpace(line))
+
+	// the account ends at two spaces or a tab
+	account, amount := line, ""
+	end := strings.Index(line, "  ")
+	if tab := strings.Index(line, "\t"); tab >= 0 && (end < 0 || tab < end) {
+		end = tab
+	}
+	if end >= 0 {
+		account, amount = line[:end], line[end:]
+	}
+	account = strings.TrimSpace(account)
+	switch {
+	case strings.HasPrefix(account, "(") && strings.HasSuffix(account, ")"):
+		posting.Type = VirtualPosting
+		account = account[1 : len(account)-1]
+	case strings.HasPrefix(account, "[") && strings.HasSuffix(account, "]"):
+		posting.Type = BalancedVirtualPosting
+		account = account[1 : len(account)-1]
+	}
+	if account == "" {
+		return posting, errors.New("posting has no account")
+	}
+	posting.Account = account
+
+	a, assertion, err := p.ctx.parsePostingAmount(strings.TrimSpace(amount))
+	if err != nil {
+		return posting, err
+	}
+	posting.Assertion = assertion
+	if a != nil {
+		posting.Amounts = []Amount{*a}
+		p.observe(*a)
+	}
+	return posting, nil
+}
+
+// observe remembers the style of a commodity as it was first written, with
+// the highest precision seen, unless a directive declared it.
+func (p *parser) observe(a Amount) {
+	if declared := p.j.Commodities[a.Commodity]; declared != (Style{}) {
+		return
+	}
+	style, ok := p.j.Styles[a.Commodity]
+	if !ok {
+		p.j.Styles[a.Commodity] = a.Style
+		return
+	}
+	if a.Style.Precision > style.Precision {
+		style.Precision = a.Style.Precision
+	}
+	if style.GroupMark == 0 {
+		style.GroupMark = a.Style.GroupMark
+	}
+	p.j.Styles[a.Commodity] = style
+}
+
+func readStatus(s string) (Status, string) {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		return Cleared, strings.TrimSpace(s[1:])
+	case strings.HasPrefix(s, "!"):
+		return Pending, strings.TrimSpace(s[1:])
+	}
+	return Unmarked, s
+}
+
+// splitComment splits a line at its ; comment.
+func splitComment(s string) (string, string) {
+	i := indexOutsideQuotes(s, ';')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i+1:])
+}
+
+func stripComment(s string) string {
+	s, _ = splitComment(s)
+	return s
+}
+
+func joinComment(comment, line string) string {
+	if comment == "" {
+		return line
+	}
+	return comment + "\n" + line
+}
+
+var tagRe = regexp.MustCompile(`(?:^|[\s,])([^\s,:]+):`)
+
+// parseTags finds name:value tags in a comment. A value runs to the next
+// comma or the end of the line, so it may contain colons itself.
+func parseTags(comment string) []Tag {
+	var tags []Tag
+	for _, line := range strings.Split(comment, "\n") {
+		for line != "" {
+			m := tagRe.FindStringSubmatchIndex(line)
+			if m == nil {
+				break
+			}
+			name := line[m[2]:m[3]]
+			value, rest, _ := strings.Cut(line[m[1]:], ",")
+			tags = append(tags, Tag{Name: name, Value: strings.TrimSpace(value)})
+			line = rest
+		}
+	}
+	return tags
+}
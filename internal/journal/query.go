@@ -0,0 +1,196 @@
+package journal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/azbashar/teka/internal/decimal"
+)
+
+// unsupportedPrefixes are hledger query prefixes ParseQuery doesn't
+// implement. They are rejected rather than taken for account regexes.
+var unsupportedPrefixes = []string{"code", "cur", "date", "date2", "depth", "expr", "note", "real", "type"}
+
+var queryStatuses = map[string]Status{"": Unmarked, "!": Pending, "*": Cleared}
+
+// ParseQuery turns hledger query terms into a filter. It understands
+// acct:REGEX, desc:REGEX, payee:REGEX, tag:NAME[=VALUE], amt:[<>=]N and
+// status:[!*], with not: in front of any of them, and takes a term
+// without a prefix for an account regex. Like hledger, regexes ignore
+// case, account, description, payee and status terms are ORed with terms
+// of the same kind, and everything else must match too.
+func ParseQuery(terms []string) (Filter, error) {
+	var f Filter
+	for _, term := range terms {
+		if err := f.addTerm(term); err != nil {
+			return Filter{}, err
+		}
+	}
+	return f, nil
+}
+
+func (f *Filter) addTerm(term string) error {
+	negate := false
+	field, arg := "acct", term
+	for strings.HasPrefix(arg, "not:") {
+		negate, arg = !negate, arg[len("not:"):]
+	}
+	if prefix, rest, ok := strings.Cut(arg, ":"); ok {
+		switch {
+		case slices.Contains([]string{"acct", "desc", "payee", "tag", "amt", "status"}, prefix):
+			field, arg = prefix, rest
+		case slices.Contains(unsupportedPrefixes, prefix):
+			return fmt.Errorf("query term %q is not supported by the native backend", term)
+		}
+	}
+
+	switch field {
+	case "acct", "desc", "payee":
+		re, err := regexp.Compile("(?i)" + arg)
+		if err != nil {
+			return fmt.Errorf("invalid query %q: %w", term, err)
+		}
+		switch {
+		case field == "acct" && negate:
+			f.Postings = append(f.Postings, func(_ *Transaction, p Posting) bool { return !re.MatchString(p.Account) })
+		case field == "acct":
+			f.Accounts = append(f.Accounts, re)
+		case field == "desc" && negate:
+			f.Headers = append(f.Headers, func(tx *Transaction) bool { return !re.MatchString(tx.Description) })
+		case field == "desc":
+			f.Descriptions = append(f.Descriptions, re)
+		case negate:
+			f.Headers = append(f.Headers, func(tx *Transaction) bool { return !re.MatchString(tx.Payee()) })
+		default:
+			f.Payees = append(f.Payees, re)
+		}
+	case "status":
+		status, ok := queryStatuses[arg]
+		if !ok {
+			return fmt.Errorf("invalid query %q, use status:*, status:! or status:", term)
+		}
+		if negate {
+			f.Postings = append(f.Postings, func(tx *Transaction, p Posting) bool { return p.EffectiveStatus(tx) != status })
+		} else {
+			f.Statuses = append(f.Statuses, status)
+		}
+	case "tag":
+		test, err := tagTest(arg)
+		if err != nil {
+			return fmt.Errorf("invalid query %q: %w", term, err)
+		}
+		f.Postings = append(f.Postings, func(tx *Transaction, p Posting) bool { return test(tx, p) != negate })
+	case "amt":
+		test, err := amountTest(arg)
+		if err != nil {
+			return fmt.Errorf("invalid query %q: %w", term, err)
+		}
+		f.Postings = append(f.Postings, func(_ *Transaction, p Posting) bool { return test(p) != negate })
+	}
+	return nil
+}
+
+// tagTest matches postings with a tag, their own or their transaction's,
+// whose name matches NAME and, if given, value matches VALUE.
+func tagTest(arg string) (func(*Transaction, Posting) bool, error) {
+	name, value, hasValue := strings.Cut(arg, "=")
+	nameRe, err := regexp.Compile("(?i)" + name)
+	if err != nil {
+		return nil, err
+	}
+	valueRe, err := regexp.Compile("(?i)" + value)
+	if err != nil {
+		return nil, err
+	}
+	match := func(tags []Tag) bool {
+		for _, t := range tags {
+			if nameRe.MatchString(t.Name) && (!hasValue || valueRe.MatchString(t.Value)) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(tx *Transaction, p Posting) bool {
+		return match(p.Tags) || match(tx.Tags)
+	}, nil
+}
+
+// amountTest compares single commodity posting amounts with N, like
+// hledger's amt: query. A signed N, or 0, is compared with the signed
+// amount, otherwise magnitudes are compared. Postings with several
+// commodities always match.
+func amountTest(arg string) (func(Posting) bool, error) {
+	op := ""
+	for _, o := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(arg, o) {
+			op, arg = o, arg[len(o):]
+			break
+		}
+	}
+	n, err := decimal.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	signed := strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+") || n.IsZero()
+	if !signed {
+		n = n.Abs()
+	}
+	return func(p Posting) bool {
+		if len(p.Amounts) != 1 {
+			return true
+		}
+		q := p.Amounts[0].Quantity
+		if !signed {
+			q = q.Abs()
+		}
+		c := q.Cmp(n)
+		switch op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+		return c == 0
+	}, nil
+}
+
+// QueryTerms splits a query into terms at spaces, like a shell does:
+// quotes keep spaces in a term, as in desc:'coffee shop'.
+func QueryTerms(query string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	var quote rune
+	inTerm := false
+	for _, r := range query {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			term.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inTerm = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inTerm {
+				terms = append(terms, term.String())
+				term.Reset()
+				inTerm = false
+			}
+		default:
+			term.WriteRune(r)
+			inTerm = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in query %q", query)
+	}
+	if inTerm {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
@@ -0,0 +1,545 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azbashar/teka/internal/decimal"
+)
+
+// MixedAmount is a sum of amounts, one per commodity.
+type MixedAmount []Amount
+
+// Add returns m with a added to the amount of its commodity. Costs are
+// dropped, like in hledger's balance reports.
+func (m MixedAmount) Add(a Amount) MixedAmount {
+	out := make(MixedAmount, len(m), len(m)+1)
+	copy(out, m)
+	for i := range out {
+		if out[i].Commodity == a.Commodity {
+			out[i].Quantity = out[i].Quantity.Add(a.Quantity)
+			return out
+		}
+	}
+	a.Cost = nil
+	return append(out, a)
+}
+
+// Plus returns the sum of m and o.
+func (m MixedAmount) Plus(o MixedAmount) MixedAmount {
+	for _, a := range o {
+		m = m.Add(a)
+	}
+	return m
+}
+
+// Of returns the quantity of the given commodity.
+func (m MixedAmount) Of(commodity string) decimal.Decimal {
+	for _, a := range m {
+		if a.Commodity == commodity {
+			return a.Quantity
+		}
+	}
+	return decimal.Decimal{}
+}
+
+// NonZero drops commodities whose quantity is zero.
+func (m MixedAmount) NonZero() MixedAmount {
+	var out MixedAmount
+	for _, a := range m {
+		if !a.Quantity.IsZero() {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Sorted returns m ordered by commodity.
+func (m MixedAmount) Sorted() MixedAmount {
+	out := slices.Clone(m)
+	slices.SortFunc(out, func(a, b Amount) int { return strings.Compare(a.Commodity, b.Commodity) })
+	return out
+}
+
+// String formats every commodity, separated by commas.
+func (m MixedAmount) String() string {
+	m = m.NonZero()
+	if len(m) == 0 {
+		return "0"
+	}
+	parts := make([]string, len(m))
+	for i, a := range m {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AtCost returns what the amount is worth at its cost, or the amount
+// itself when it has none. This is the amount's weight when balancing a
+// transaction.
+func (a Amount) AtCost() Amount {
+	if a.Cost == nil {
+		return a
+	}
+	c := a.Cost.Amount
+	if a.Cost.Total {
+		c.Quantity = c.Quantity.Abs()
+		if a.Quantity.Sign() < 0 {
+			c.Quantity = c.Quantity.Neg()
+		}
+	} else {
+		c.Quantity = a.Quantity.Mul(c.Quantity)
+	}
+	c.Cost = nil
+	return c
+}
+
+// finalize numbers the transactions, then, in date order like hledger,
+// sets the amounts of balance assignments, infers missing amounts, checks
+// that every transaction balances and every balance assertion holds.
+func (j *Journal) finalize() error {
+	for i := range j.Transactions {
+		j.Transactions[i].Index = i + 1
+	}
+	balances := map[string]MixedAmount{}
+	for _, tx := range j.sorted() {
+		j.assign(tx, balances)
+		if err := j.balance(tx); err != nil {
+			return &ParseError{File: tx.Pos.File, Line: tx.Pos.Line, Err: err}
+		}
+		if err := checkAssertions(tx, balances); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assign sets the amount of each posting with a balance assignment, a
+// balance assertion without an amount, to what takes the account's balance
+// to the asserted one. balances are those before the transaction; the
+// postings before an assignment in the transaction count too.
+func (j *Journal) assign(tx *Transaction, balances map[string]MixedAmount) {
+	local := map[string]MixedAmount{}
+	balance := func(account string, inclusive bool) MixedAmount {
+		if !inclusive {
+			return balances[account].Plus(local[account])
+		}
+		return Inclusive(balances, account).Plus(Inclusive(local, account))
+	}
+	for i := range tx.Postings {
+		p := &tx.Postings[i]
+		if len(p.Amounts) == 0 && p.Assertion != nil {
+			p.Inferred = true
+			want := p.Assertion.Amount
+			want.Cost = nil
+			current := balance(p.Account, p.Assertion.Inclusive)
+			want.Quantity = want.Quantity.Sub(current.Of(want.Commodity))
+			p.Amounts = []Amount{want}
+			// == leaves no other commodity in the account
+			if p.Assertion.Total {
+				for _, a := range current.NonZero() {
+					if a.Commodity != want.Commodity {
+						a.Quantity = a.Quantity.Neg()
+						p.Amounts = append(p.Amounts, a)
+					}
+				}
+			}
+		}
+		for _, a := range p.Amounts {
+			local[p.Account] = local[p.Account].Add(a)
+		}
+	}
+}
+
+// balance fills in the amount of a posting left without one and checks
+// that the real postings, and separately the [balanced virtual] ones, sum
+// to zero.
+func (j *Journal) balance(tx *Transaction) error {
+	for _, kind := range []PostingType{RegularPosting, BalancedVirtualPosting} {
+		var sum MixedAmount
+		var missing []int
+		hasCost := false
+		for i, p := range tx.Postings {
+			if p.Type != kind {
+				continue
+			}
+			if len(p.Amounts) == 0 {
+				missing = append(missing, i)
+				continue
+			}
+			for _, a := range p.Amounts {
+				hasCost = hasCost || a.Cost != nil
+				sum = sum.Add(a.AtCost())
+			}
+		}
+
+		switch {
+		case len(missing) > 1:
+			return errors.New("more than one posting without an amount")
+		case len(missing) == 1:
+			p := &tx.Postings[missing[0]]
+			p.Inferred = true
+			for _, a := range sum.NonZero() {
+				a.Quantity = a.Quantity.Neg()
+				if style, ok := j.Styles[a.Commodity]; ok {
+					a.Style = style
+					a.Quantity = withPrecision(a.Quantity, style.Precision)
+				}
+				p.Amounts = append(p.Amounts, a)
+			}
+			if len(p.Amounts) == 0 {
+				p.Amounts = []Amount{{}}
+			}
+		default:
+			unbalanced := j.round(sum).NonZero()
+			// two commodities without costs are a conversion whose cost
+			// hledger infers
+			if len(unbalanced) == 0 || (len(unbalanced) == 2 && !hasCost) {
+				continue
+			}
+			return fmt.Errorf("transaction is unbalanced by %s", unbalanced)
+		}
+	}
+	return nil
+}
+
+// withPrecision drops the extra zero decimals a multiplication leaves and
+// pads to the display precision, without losing any nonzero digit.
+func withPrecision(q decimal.Decimal, precision int) decimal.Decimal {
+	q = q.Normalize()
+	if q.Places() < precision {
+		q = q.WithPlaces(precision)
+	}
+	return q
+}
+
+// round rounds each amount to its commodity's display precision.
+func (j *Journal) round(m MixedAmount) MixedAmount {
+	out := make(MixedAmount, len(m))
+	for i, a := range m {
+		if style, ok := j.Styles[a.Commodity]; ok {
+			a.Quantity = a.Quantity.Round(style.Precision)
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// checkAssertions adds the postings of tx to balances and checks their
+// balance assertions.
+func checkAssertions(tx *Transaction, balances map[string]MixedAmount) error {
+	for _, p := range tx.Postings {
+		for _, a := range p.Amounts {
+			balances[p.Account] = balances[p.Account].Add(a)
+		}
+		if p.Assertion == nil {
+			continue
+		}
+		actual := balances[p.Account]
+		if p.Assertion.Inclusive {
+			actual = Inclusive(balances, p.Account)
+		}
+		want := p.Assertion.Amount
+		got := actual.Of(want.Commodity)
+		ok := got.Cmp(want.Quantity) == 0
+		if ok && p.Assertion.Total {
+			for _, a := range actual.NonZero() {
+				if a.Commodity != want.Commodity {
+					ok = false
+				}
+			}
+		}
+		if !ok {
+			return &ParseError{File: p.Pos.File, Line: p.Pos.Line, Err: fmt.Errorf(
+				"balance assertion failed in %s: asserted %s, but the balance is %s",
+				p.Account, want.String(), actual.String())}
+		}
+	}
+	return nil
+}
+
+// sorted returns the transactions ordered by date, keeping the file order
+// of transactions on the same day.
+func (j *Journal) sorted() []*Transaction {
+	txs := make([]*Transaction, len(j.Transactions))
+	for i := range j.Transactions {
+		txs[i] = &j.Transactions[i]
+	}
+	sort.SliceStable(txs, func(a, b int) bool {
+		return txs[a].Date.Before(txs[b].Date)
+	})
+	return txs
+}
+
+// Inclusive returns the balance of account and all its subaccounts, with
+// the commodities sorted like hledger shows them. The balances are summed
+// in map order, so their order would change from one call to the next.
+func Inclusive(balances map[string]MixedAmount, account string) MixedAmount {
+	var sum MixedAmount
+	for name, b := range balances {
+		if name == account || strings.HasPrefix(name, account+":") {
+			sum = sum.Plus(b)
+		}
+	}
+	return sum.Sorted()
+}
+
+// Filter selects what a report looks at. The zero Filter matches
+// everything.
+type Filter struct {
+	Begin time.Time // first day, inclusive
+	End   time.Time // exclusive
+	// Accounts matches posting accounts; a transaction matches when any
+	// of its postings does.
+	Accounts []*regexp.Regexp
+	// Descriptions matches transaction descriptions.
+	Descriptions []*regexp.Regexp
+	// Payees matches transaction payees.
+	Payees []*regexp.Regexp
+	// Statuses matches the status of postings, or of their transaction
+	// when they have none.
+	Statuses []Status
+	// Headers and Postings are further tests on transactions and on their
+	// postings, all of which must pass.
+	Headers  []func(*Transaction) bool
+	Postings []func(*Transaction, Posting) bool
+	// Transaction is an extra test on whole transactions.
+	Transaction func(*Transaction) bool
+}
+
+// matchHeader checks everything but the postings.
+func (f Filter) matchHeader(tx *Transaction) bool {
+	if !f.Begin.IsZero() && tx.Date.Before(f.Begin) {
+		return false
+	}
+	if !f.End.IsZero() && !tx.Date.Before(f.End) {
+		return false
+	}
+	if f.Transaction != nil && !f.Transaction(tx) {
+		return false
+	}
+	for _, test := range f.Headers {
+		if !test(tx) {
+			return false
+		}
+	}
+	return (len(f.Descriptions) == 0 || anyMatch(f.Descriptions, tx.Description)) &&
+		(len(f.Payees) == 0 || anyMatch(f.Payees, tx.Payee()))
+}
+
+func (f Filter) matchTransaction(tx *Transaction) bool {
+	if !f.matchHeader(tx) {
+		return false
+	}
+	if len(f.Accounts) == 0 && len(f.Statuses) == 0 && len(f.Postings) == 0 {
+		return true
+	}
+	for _, p := range tx.Postings {
+		if f.MatchPosting(tx, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPosting reports whether a posting of tx matches the posting terms:
+// accounts, statuses and posting tests. The transaction itself is not
+// checked.
+func (f Filter) MatchPosting(tx *Transaction, p Posting) bool {
+	if !f.MatchAccount(p.Account) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, p.EffectiveStatus(tx)) {
+		return false
+	}
+	for _, test := range f.Postings {
+		if !test(tx, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchAccount reports whether an account name matches the account terms.
+func (f Filter) MatchAccount(name string) bool {
+	return len(f.Accounts) == 0 || anyMatch(f.Accounts, name)
+}
+
+func anyMatch(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the matching transactions in date order, like
+// `hledger print`.
+func (j *Journal) Select(f Filter) []Transaction {
+	var out []Transaction
+	for _, tx := range j.sorted() {
+		if f.matchTransaction(tx) {
+			out = append(out, *tx)
+		}
+	}
+	return out
+}
+
+// Balances returns the balance of every account with matching postings,
+// not including subaccounts. Use Inclusive for tree totals.
+func (j *Journal) Balances(f Filter) map[string]MixedAmount {
+	balances := map[string]MixedAmount{}
+	for _, tx := range j.sorted() {
+		if !f.matchHeader(tx) {
+			continue
+		}
+		for _, p := range tx.Postings {
+			if !f.MatchPosting(tx, p) {
+				continue
+			}
+			for _, a := range p.Amounts {
+				balances[p.Account] = balances[p.Account].Add(a)
+			}
+		}
+	}
+	return balances
+}
+
+// RegisterRow is one posting of a register report with the running total
+// of the postings up to and including it.
+type RegisterRow struct {
+	Transaction *Transaction
+	Posting     *Posting
+	Total       MixedAmount
+}
+
+// Register returns the matching postings in date order with running
+// totals, like `hledger register`.
+func (j *Journal) Register(f Filter) []RegisterRow {
+	var rows []RegisterRow
+	var total MixedAmount
+	for _, tx := range j.sorted() {
+		if !f.matchHeader(tx) {
+			continue
+		}
+		for i := range tx.Postings {
+			p := &tx.Postings[i]
+			if !f.MatchPosting(tx, *p) {
+				continue
+			}
+			for _, a := range p.Amounts {
+				total = total.Add(a)
+			}
+			rows = append(rows, RegisterRow{Transaction: tx, Posting: p, Total: total})
+		}
+	}
+	return rows
+}
+
+// AccountNames returns the declared accounts in declaration order, then
+// the other accounts used by postings, sorted, like `hledger accounts`.
+func (j *Journal) AccountNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, a := range j.Accounts {
+		if !seen[a.Name] {
+			seen[a.Name] = true
+			names = append(names, a.Name)
+		}
+	}
+	var used []string
+	for _, tx := range j.Transactions {
+		for _, p := range tx.Postings {
+			if !seen[p.Account] {
+				seen[p.Account] = true
+				used = append(used, p.Account)
+			}
+		}
+	}
+	sort.Strings(used)
+	return append(names, used...)
+}
+
+// inferredTypes are the account names hledger infers types from, cash and
+// conversion accounts first so they win over their parents' types.
+var inferredTypes = []struct {
+	name *regexp.Regexp
+	code string
+}{
+	{regexp.MustCompile(`(?i)^assets?(:.+)?:(cash|bank|savings?|checking|current)(:|$)`), "C"},
+	{regexp.MustCompile(`(?i)^assets?(:|$)`), "A"},
+	{regexp.MustCompile(`(?i)^(debts?|liabilit(y|ies))(:|$)`), "L"},
+	{regexp.MustCompile(`(?i)^equity:(trad(e|ing)|conversion)s?(:|$)`), "V"},
+	{regexp.MustCompile(`(?i)^equity(:|$)`), "E"},
+	{regexp.MustCompile(`(?i)^(income|revenue)s?(:|$)`), "R"},
+	{regexp.MustCompile(`(?i)^expenses?(:|$)`), "X"},
+}
+
+// AccountType returns the type of an account like `hledger accounts
+// --types`: the type declared for it or its closest parent with one, or
+// else the type its name suggests. It is "" when neither says.
+func (j *Journal) AccountType(name string) string {
+	for parent := name; parent != ""; {
+		for _, a := range j.Accounts {
+			if a.Name == parent && a.Type != "" {
+				return a.Type
+			}
+		}
+		i := strings.LastIndex(parent, ":")
+		if i < 0 {
+			break
+		}
+		parent = parent[:i]
+	}
+	for _, t := range inferredTypes {
+		if t.name.MatchString(name) {
+			return t.code
+		}
+	}
+	return ""
+}
+
+// Value converts an amount to the target commodity with the latest market
+// price on or before date, from P directives. It returns false when no
+// price is known.
+func (j *Journal) Value(a Amount, target string, date time.Time) (Amount, bool) {
+	if a.Commodity == target {
+		return a, true
+	}
+	var best *Price
+	reverse := false
+	for i := range j.Prices {
+		p := &j.Prices[i]
+		if p.Date.After(date) || (best != nil && p.Date.Before(best.Date)) {
+			continue
+		}
+		switch {
+		case p.Commodity == a.Commodity && p.Amount.Commodity == target:
+			best, reverse = p, false
+		case p.Commodity == target && p.Amount.Commodity == a.Commodity:
+			best, reverse = p, true
+		}
+	}
+	if best == nil {
+		return a, false
+	}
+
+	style := j.Styles[target]
+	out := Amount{Commodity: target, Style: style}
+	if reverse {
+		q, err := a.Quantity.Div(best.Amount.Quantity, max(style.Precision, 8))
+		if err != nil {
+			return a, false
+		}
+		out.Quantity = withPrecision(q, style.Precision)
+	} else {
+		out.Quantity = withPrecision(a.Quantity.Mul(best.Amount.Quantity), style.Precision)
+	}
+	return out, true
+}
@@ -0,0 +1,176 @@
+// Package journal is a native, read-only reader for the common subset of
+// hledger's journal format: transactions, postings, comments and tags,
+// include, account, commodity, D, Y and P directives, balance assertions
+// and @/@@ costs. It lets teka answer simple reports without running the
+// hledger binary. Anything it doesn't understand is skipped; `hledger
+// check` stays the authority on whether a journal is valid.
+package journal
+
+import (
+	"strings"
+	"time"
+
+	"github.com/azbashar/teka/internal/decimal"
+)
+
+// Style is how a commodity's amounts are written.
+type Style struct {
+	Side        byte // 'L' for $1.00, 'R' for 1.00 USD
+	Spaced      bool // a space between commodity and number
+	DecimalMark byte // '.' or ','
+	GroupMark   byte // digit group mark, 0 for none
+	Precision   int  // number of decimals
+}
+
+// Amount is a quantity of one commodity, optionally with a cost.
+type Amount struct {
+	Quantity  decimal.Decimal
+	Commodity string
+	Style     Style
+	Cost      *Cost
+}
+
+// Cost is the @ (unit) or @@ (total) cost of an amount.
+type Cost struct {
+	Total  bool
+	Amount Amount
+}
+
+// Status is a transaction or posting mark.
+type Status string
+
+const (
+	Unmarked Status = ""
+	Pending  Status = "!"
+	Cleared  Status = "*"
+)
+
+// Tag is a name:value tag from a comment.
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Pos is where something was read from. Lines are 1-based and EndLine is
+// the last line that belongs to it.
+type Pos struct {
+	File      string
+	Line      int
+	EndLine   int
+	Column    int
+	EndColumn int
+}
+
+// PostingType tells real postings from virtual ones.
+type PostingType int
+
+const (
+	RegularPosting         PostingType = iota
+	VirtualPosting                     // (account), not balanced
+	BalancedVirtualPosting             // [account], balanced among themselves
+)
+
+// Posting is one account line of a transaction. When the amount was left
+// out, Amounts holds the amounts that balance the transaction, or that its
+// balance assignment sets, and Inferred is set.
+type Posting struct {
+	Status    Status
+	Account   string
+	Type      PostingType
+	Amounts   []Amount
+	Inferred  bool
+	Assertion *Assertion
+	Comment   string
+	Tags      []Tag
+	Pos       Pos
+}
+
+// EffectiveStatus is the posting's status, or the status of its
+// transaction when it has none.
+func (p Posting) EffectiveStatus(tx *Transaction) Status {
+	if p.Status != Unmarked {
+		return p.Status
+	}
+	return tx.Status
+}
+
+// Assertion is a balance assertion after a posting amount, or a balance
+// assignment when the posting has no amount. Total (==) asserts there is
+// no other commodity in the account, Inclusive (=*) includes subaccounts.
+type Assertion struct {
+	Amount    Amount
+	Total     bool
+	Inclusive bool
+}
+
+// Transaction is a journal entry.
+type Transaction struct {
+	Index       int // 1-based, in the order transactions were read
+	Date        time.Time
+	Date2       *time.Time
+	Status      Status
+	Code        string
+	Description string
+	Comment     string
+	Tags        []Tag
+	Postings    []Posting
+	Pos         Pos
+}
+
+// Payee is the part of the description before "|", or all of it.
+func (t Transaction) Payee() string {
+	payee, _, _ := strings.Cut(t.Description, "|")
+	return strings.TrimSpace(payee)
+}
+
+// Note is the part of the description after "|", or all of it.
+func (t Transaction) Note() string {
+	_, note, ok := strings.Cut(t.Description, "|")
+	if !ok {
+		return strings.TrimSpace(t.Description)
+	}
+	return strings.TrimSpace(note)
+}
+
+// Tag returns the value of the first transaction tag with the given name.
+func (t Transaction) Tag(name string) (string, bool) {
+	return findTag(t.Tags, name)
+}
+
+func findTag(tags []Tag, name string) (string, bool) {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// AccountDecl is an account directive.
+type AccountDecl struct {
+	Name    string
+	Type    string // A, L, E, R, X, C or V from a type: tag, if any
+	Comment string
+	Tags    []Tag
+	Pos     Pos
+}
+
+// Price is a P directive: one unit of Commodity cost Amount on Date.
+type Price struct {
+	Date      time.Time
+	Commodity string
+	Amount    Amount
+}
+
+// Journal is everything read from a journal and the files it includes.
+type Journal struct {
+	Files        []string
+	Transactions []Transaction
+	Accounts     []AccountDecl
+	// Commodities holds the styles declared with commodity directives.
+	Commodities map[string]Style
+	// Styles holds the style of every commodity, declared or as first seen
+	// in an amount, with the highest precision seen.
+	Styles map[string]Style
+	Prices []Price
+}
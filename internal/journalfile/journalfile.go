@@ -0,0 +1,202 @@
+// Package journalfile writes entries to journal files. Every write holds
+// an advisory lock on the file, so Teka processes and the web server take
+// turns, and is recorded in the write log.
+package journalfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/azbashar/teka/internal/filelock"
+	"github.com/azbashar/teka/internal/writelog"
+)
+
+// ErrNotLogged is returned with the entry when it was written but could
+// not be recorded in the write log.
+var ErrNotLogged = errors.New("the write could not be logged")
+
+// Append adds content to the end of the journal at path and records the
+// write. When the file doesn't end with a newline one is added first, so
+// the entry doesn't run into the last line. The returned entry describes
+// the write even when the error is ErrNotLogged.
+func Append(path, content string) (writelog.Entry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return writelog.Entry{}, err
+	}
+	defer f.Close()
+	if err := filelock.Lock(f); err != nil {
+		return writelog.Entry{}, err
+	}
+	defer filelock.Unlock(f)
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return writelog.Entry{}, err
+	}
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return writelog.Entry{}, err
+		}
+		if last[0] != '\n' {
+			if _, err := f.WriteAt([]byte("\n"), size); err != nil {
+				return writelog.Entry{}, err
+			}
+			size++
+		}
+	}
+	if _, err := f.WriteAt([]byte(content), size); err != nil {
+		// don't leave half an entry behind
+		f.Truncate(size)
+		return writelog.Entry{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return writelog.Entry{}, err
+	}
+	e, err := writelog.Record(path, size, []byte(content))
+	if err != nil {
+		return e, fmt.Errorf("%w: %v", ErrNotLogged, err)
+	}
+	return e, nil
+}
+
+// Remove takes a recorded write back out of its file and drops it from
+// the log. It returns writelog.ErrChanged, and leaves the file alone, when
+// the entry's bytes are not what was written anymore. Whatever was added
+// after the entry stays and moves up.
+func Remove(e writelog.Entry) error {
+	if err := splice(e, ""); err != nil {
+		return err
+	}
+	return writelog.Forget(e)
+}
+
+// Replace puts content in place of a recorded write, after checking its
+// bytes are unchanged, and updates the log. It returns the updated entry.
+func Replace(e writelog.Entry, content string) (writelog.Entry, error) {
+	if err := splice(e, content); err != nil {
+		return e, err
+	}
+	return writelog.Replace(e, []byte(content))
+}
+
+// Rewrite puts content in place of bytes found with Locate, after checking
+// they are unchanged, and moves the logged writes after them. It returns
+// the entry of the new bytes, even when the error is ErrNotLogged because
+// the log could not be updated. The rewrite itself is not logged, teka
+// undo only takes back what Teka added.
+func Rewrite(e writelog.Entry, content string) (writelog.Entry, error) {
+	if err := splice(e, content); err != nil {
+		return e, err
+	}
+	updated := e
+	updated.Length = int64(len(content))
+	updated.Hash = writelog.Hash([]byte(content))
+	if err := writelog.Moved(e.File, e.Offset, updated.Length-e.Length); err != nil {
+		return updated, fmt.Errorf("%w: %v", ErrNotLogged, err)
+	}
+	return updated, nil
+}
+
+// splice replaces the bytes of e with content, holding the file's lock.
+// It returns writelog.ErrChanged when they are not the entry's anymore.
+func splice(e writelog.Entry, content string) error {
+	f, err := os.OpenFile(e.File, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := filelock.Lock(f); err != nil {
+		return err
+	}
+	defer filelock.Unlock(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if err := e.CheckContent(data); err != nil {
+		return err
+	}
+
+	rest := append([]byte(content), data[e.Offset+e.Length:]...)
+	if _, err := f.WriteAt(rest, e.Offset); err != nil {
+		return err
+	}
+	if err := f.Truncate(e.Offset + int64(len(rest))); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Content returns the bytes of a recorded write, or writelog.ErrChanged
+// when they are not what was written anymore.
+func Content(e writelog.Entry) (string, error) {
+	data, err := os.ReadFile(e.File)
+	if err != nil {
+		return "", err
+	}
+	if err := e.CheckContent(data); err != nil {
+		return "", err
+	}
+	return string(data[e.Offset : e.Offset+e.Length]), nil
+}
+
+// Lines is a journal file read to find entries by line number, like the
+// source positions hledger reports for transactions.
+type Lines struct {
+	file   string
+	data   []byte
+	starts []int // where each line starts
+}
+
+// ReadLines reads the file at path.
+func ReadLines(path string) (*Lines, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			starts = append(starts, i+1)
+		}
+	}
+	return &Lines{file: abs, data: data, starts: starts}, nil
+}
+
+// Entry describes lines line to endLine, 1-based and inclusive, as an
+// entry that Rewrite can replace.
+func (l *Lines) Entry(line, endLine int) (writelog.Entry, error) {
+	if line < 1 || endLine < line || endLine > len(l.starts) {
+		return writelog.Entry{}, fmt.Errorf("%s has no lines %d-%d", l.file, line, endLine)
+	}
+	start, end := l.starts[line-1], len(l.data)
+	if endLine < len(l.starts) {
+		end = l.starts[endLine]
+	}
+	return writelog.Entry{
+		File:   l.file,
+		Offset: int64(start),
+		Length: int64(end - start),
+		Hash:   writelog.Hash(l.data[start:end]),
+	}, nil
+}
+
+// Locate describes lines line to endLine of the file at path, see
+// Lines.Entry.
+func Locate(path string, line, endLine int) (writelog.Entry, error) {
+	l, err := ReadLines(path)
+	if err != nil {
+		return writelog.Entry{}, err
+	}
+	return l.Entry(line, endLine)
+}
@@ -0,0 +1,92 @@
+package prompt
+
+import (
+	"sort"
+	"strings"
+)
+
+// Match returns the candidates the pattern matches, best match first.
+//
+// A pattern matches a candidate that starts with it, one whose
+// colon-separated segments start with the pattern's segments in order (so
+// "e:f:gro" matches "expenses:food:groceries" and "gro" matches it too),
+// one that contains it, or one that contains its letters in order. Case is
+// ignored. Among equally good matches shorter candidates come first, then
+// the order they were given in.
+func Match(pattern string, candidates []string) []string {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	type match struct {
+		candidate string
+		score     int
+	}
+	var matches []match
+	for _, c := range candidates {
+		if score, ok := score(pattern, strings.ToLower(c)); ok {
+			matches = append(matches, match{c, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].score != matches[b].score {
+			return matches[a].score < matches[b].score
+		}
+		return len(matches[a].candidate) < len(matches[b].candidate)
+	})
+
+	out := make([]string, len(matches))
+	for i, m := range matches {
+		out[i] = m.candidate
+	}
+	return out
+}
+
+// score rates how well a lowercase pattern matches a lowercase candidate,
+// lower is better.
+func score(pattern, candidate string) (int, bool) {
+	switch {
+	case pattern == "":
+		return 0, true
+	case candidate == pattern:
+		return 0, true
+	case strings.HasPrefix(candidate, pattern):
+		return 1, true
+	}
+	if skipped, ok := matchSegments(strings.Split(pattern, ":"), strings.Split(candidate, ":")); ok {
+		return 2 + skipped, true
+	}
+	if strings.Contains(candidate, pattern) {
+		return 100, true
+	}
+	if isSubsequence(pattern, candidate) {
+		return 200, true
+	}
+	return 0, false
+}
+
+// matchSegments reports whether each pattern segment is a prefix of a
+// candidate segment, in order, and how many candidate segments were
+// skipped on the way. An empty pattern segment matches any segment.
+func matchSegments(pattern, candidate []string) (int, bool) {
+	skipped := 0
+	i := 0
+	for _, p := range pattern {
+		for i < len(candidate) && !strings.HasPrefix(candidate[i], p) {
+			i++
+			skipped++
+		}
+		if i == len(candidate) {
+			return 0, false
+		}
+		i++
+	}
+	return skipped, true
+}
+
+func isSubsequence(pattern, candidate string) bool {
+	rest := []rune(pattern)
+	for _, r := range candidate {
+		if len(rest) > 0 && r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
@@ -0,0 +1,141 @@
+// Package prompt reads answers at the terminal with line editing, per
+// question history and fuzzy tab completion.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned when the user pressed Ctrl-C or Ctrl-D at a
+// prompt.
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns the completions for what was typed, best first. Each
+// completion replaces the whole line.
+type Completer func(line string) []string
+
+// Editor asks questions on a terminal. When the input is not a terminal,
+// for example when answers are piped in, lines are read as they are.
+type Editor struct {
+	in  *os.File
+	out io.Writer
+	// reader reads input that is not a terminal, it is shared by all
+	// prompts so answers piped in together are not lost in its buffer
+	reader   *bufio.Reader
+	terminal *term.Terminal
+	// history of answers, by question
+	history map[string]*history
+}
+
+// NewEditor returns an editor reading from in and writing to out.
+func NewEditor(in *os.File, out io.Writer) *Editor {
+	return &Editor{
+		in:      in,
+		out:     out,
+		reader:  bufio.NewReader(in),
+		history: map[string]*history{},
+	}
+}
+
+// Ask prints the question and reads the answer. Up and down arrows go
+// through earlier answers to the same question. Tab replaces the line with
+// the best completion, pressing it again cycles through the others. The
+// answer is trimmed.
+func (e *Editor) Ask(question string, complete Completer) (string, error) {
+	fd := int(e.in.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprint(e.out, question+" ")
+		line, err := e.reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	if e.terminal == nil {
+		e.terminal = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{e.in, e.out}, "")
+	}
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		e.terminal.SetSize(width, height)
+	}
+	if e.history[question] == nil {
+		e.history[question] = &history{}
+	}
+	e.terminal.History = e.history[question]
+	e.terminal.AutoCompleteCallback = (&completion{complete: complete}).callback
+	e.terminal.SetPrompt(question + " ")
+
+	line, err := e.terminal.ReadLine()
+	if err == io.EOF {
+		return "", ErrInterrupted
+	}
+	if err != nil && err != term.ErrPasteIndicator {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// completion is the tab completion state of one prompt.
+type completion struct {
+	complete Completer
+	// the completions being cycled through and the one on the line
+	matches []string
+	current int
+}
+
+func (c *completion) callback(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || c.complete == nil {
+		c.matches = nil
+		return "", 0, false
+	}
+	if len(c.matches) > 0 && line == c.matches[c.current] {
+		c.current = (c.current + 1) % len(c.matches)
+	} else {
+		c.matches, c.current = c.complete(line), 0
+		if len(c.matches) == 0 {
+			return line, pos, true
+		}
+	}
+	completed := c.matches[c.current]
+	return completed, len(completed), true
+}
+
+// history implements term.History without a size limit or duplicates of
+// the latest entry.
+type history struct {
+	entries []string
+}
+
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+}
+
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+func (h *history) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
@@ -0,0 +1,178 @@
+// Package watcher notices changes to the journals and the config file and
+// hands them out to subscribers, such as the /api/events stream.
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azbashar/teka/internal/fileselector"
+)
+
+const (
+	EventJournal = "journal"
+	EventConfig  = "config"
+)
+
+// DefaultInterval is how often files are checked for changes.
+const DefaultInterval = time.Second
+
+// Event is published when watched files change.
+type Event struct {
+	Type  string    `json:"type"`
+	Files []string  `json:"files"`
+	Time  time.Time `json:"time"`
+}
+
+type fileState struct {
+	modTime  time.Time
+	size     int64
+	missing  bool
+	includes []string
+}
+
+func (s fileState) changed(o fileState) bool {
+	return s.missing != o.missing || s.size != o.size || !s.modTime.Equal(o.modTime)
+}
+
+// Watcher polls the journals returned by roots, the files they include and
+// the config file. Polling keeps it working the same on every platform and
+// with editors that replace files instead of writing them in place.
+type Watcher struct {
+	roots      func() []string
+	configFile string
+	interval   time.Duration
+
+	// OnConfigChange is called before a config event is published.
+	OnConfigChange func()
+
+	journals map[string]fileState
+	config   fileState
+
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// New returns a watcher for the journals returned by roots and for
+// configFile. Call Start to begin watching.
+func New(roots func() []string, configFile string, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{
+		roots:      roots,
+		configFile: configFile,
+		interval:   interval,
+		journals:   map[string]fileState{},
+		subs:       map[chan Event]struct{}{},
+	}
+}
+
+// Start checks the files once to learn their current state, then keeps
+// polling in the background.
+func (w *Watcher) Start() {
+	w.config = stat(w.configFile)
+	w.journals, _ = w.scan()
+	go func() {
+		for range time.Tick(w.interval) {
+			w.poll()
+		}
+	}()
+}
+
+// Subscribe returns a channel receiving every event from now on, and a
+// function to stop the subscription.
+func (w *Watcher) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+	w.mu.Lock()
+	w.subs[ch] = struct{}{}
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subs, ch)
+		w.mu.Unlock()
+	}
+}
+
+func (w *Watcher) publish(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		// a subscriber that doesn't keep up misses events, it will pick
+		// up the latest state with the next one
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (w *Watcher) poll() {
+	if w.configFile != "" {
+		if s := stat(w.configFile); s.changed(w.config) {
+			w.config = s
+			if w.OnConfigChange != nil {
+				w.OnConfigChange()
+			}
+			w.publish(Event{Type: EventConfig, Files: []string{w.configFile}, Time: time.Now()})
+		}
+	}
+
+	journals, changed := w.scan()
+	w.journals = journals
+	if len(changed) > 0 {
+		w.publish(Event{Type: EventJournal, Files: changed, Time: time.Now()})
+	}
+}
+
+// scan stats every journal reachable from the roots. Include directives are
+// only read again from files that changed since the last scan.
+func (w *Watcher) scan() (map[string]fileState, []string) {
+	states := map[string]fileState{}
+	var changed []string
+
+	var visit func(path string)
+	visit = func(path string) {
+		path = filepath.Clean(fileselector.ExpandHome(path))
+		if _, ok := states[path]; ok {
+			return
+		}
+		s := stat(path)
+		prev, known := w.journals[path]
+		if known && !s.changed(prev) {
+			s.includes = prev.includes
+		} else {
+			if !s.missing {
+				s.includes = fileselector.Includes(path)
+			}
+			changed = append(changed, path)
+		}
+		states[path] = s
+		for _, inc := range s.includes {
+			visit(inc)
+		}
+	}
+	for _, root := range w.roots() {
+		visit(root)
+	}
+
+	// files that are no longer reachable count as changed too
+	for path := range w.journals {
+		if _, ok := states[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return states, changed
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{missing: true}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
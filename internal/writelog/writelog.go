@@ -0,0 +1,243 @@
+// Package writelog records the entries Teka writes to journals, so they
+// can be listed and taken back later. The writes themselves are done by
+// package journalfile.
+package writelog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/azbashar/teka/internal/filelock"
+)
+
+// MaxEntries bounds the log. The oldest entries are dropped when a write
+// would exceed it.
+const MaxEntries = 1000
+
+// Entry is one write: Length bytes at Offset of File, with the SHA-256
+// hash they had when they were written.
+type Entry struct {
+	File    string    `json:"file"`
+	Offset  int64     `json:"offset"`
+	Length  int64     `json:"length"`
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	Summary string    `json:"summary"` // first line of the entry
+}
+
+// ErrChanged is returned when the bytes of an entry are no longer the ones
+// that were written.
+var ErrChanged = errors.New("entry was changed since it was written")
+
+// Path is the log file, next to the config file.
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get write log path: %w", err)
+	}
+	dir = filepath.Join(dir, "teka")
+	_ = os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, "writelog.jsonl"), nil
+}
+
+// Record logs that content was written at offset of file.
+func Record(file string, offset int64, content []byte) (Entry, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{
+		File:    abs,
+		Offset:  offset,
+		Length:  int64(len(content)),
+		Hash:    Hash(content),
+		Time:    time.Now(),
+		Summary: summary(content),
+	}
+
+	err = update(func(entries []Entry) []Entry {
+		entries = append(entries, e)
+		if len(entries) > MaxEntries {
+			entries = entries[len(entries)-MaxEntries:]
+		}
+		return entries
+	})
+	return e, err
+}
+
+// Read returns the logged writes, oldest first. A missing log is empty.
+func Read() ([]Entry, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, data)
+}
+
+func parse(path string, data []byte) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("invalid write log %s: %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Forget drops an entry from the log once its bytes were taken out of its
+// file. Entries after it in the same file move up by its length.
+func Forget(e Entry) error {
+	return update(func(entries []Entry) []Entry {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].same(e) {
+				entries = append(entries[:i], entries[i+1:]...)
+				break
+			}
+		}
+		shift(entries, e, -e.Length)
+		return entries
+	})
+}
+
+// Replace records that the entry's bytes were replaced with content and
+// returns the updated entry. Entries after it in the same file move by the
+// change in length.
+func Replace(e Entry, content []byte) (Entry, error) {
+	updated := e
+	updated.Length = int64(len(content))
+	updated.Hash = Hash(content)
+	updated.Summary = summary(content)
+	err := update(func(entries []Entry) []Entry {
+		for i := range entries {
+			if entries[i].same(e) {
+				entries[i] = updated
+			}
+		}
+		shift(entries, e, updated.Length-e.Length)
+		return entries
+	})
+	return updated, err
+}
+
+// Moved records that the bytes after offset of file moved by delta
+// because something before them, that isn't a logged write, was edited.
+func Moved(file string, offset, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	return update(func(entries []Entry) []Entry {
+		shift(entries, Entry{File: file, Offset: offset}, delta)
+		return entries
+	})
+}
+
+// shift moves the entries after e in its file by delta bytes.
+func shift(entries []Entry, e Entry, delta int64) {
+	for i := range entries {
+		if entries[i].File == e.File && entries[i].Offset > e.Offset {
+			entries[i].Offset += delta
+		}
+	}
+}
+
+// Check returns ErrChanged unless the entry's bytes are still in its file
+// as they were written.
+func Check(e Entry) error {
+	data, err := os.ReadFile(e.File)
+	if err != nil {
+		return err
+	}
+	return e.CheckContent(data)
+}
+
+// CheckContent is Check against data, the contents of the entry's file.
+func (e Entry) CheckContent(data []byte) error {
+	end := e.Offset + e.Length
+	if e.Offset < 0 || end > int64(len(data)) || Hash(data[e.Offset:end]) != e.Hash {
+		return ErrChanged
+	}
+	return nil
+}
+
+func (e Entry) same(o Entry) bool {
+	return e.File == o.File && e.Offset == o.Offset && e.Hash == o.Hash && e.Time.Equal(o.Time)
+}
+
+// update rewrites the log with what change makes of its entries, holding
+// a lock on the log so concurrent writes don't lose each other's entries.
+func update(change func([]Entry) []Entry) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := filelock.Lock(f); err != nil {
+		return err
+	}
+	defer filelock.Unlock(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	entries, err := parse(path, data)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, e := range change(entries) {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(b.Bytes(), 0)
+	return err
+}
+
+// Hash is the hash entries record of their bytes.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func summary(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}